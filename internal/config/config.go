@@ -4,14 +4,21 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Pagination PaginationConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	Pagination  PaginationConfig
+	Currency    CurrencyConfig
+	Idempotency IdempotencyConfig
+	Batch       BatchConfig
+	Webhook     WebhookConfig
+	Outbox      OutboxConfig
 }
 
 type ServerConfig struct {
@@ -33,6 +40,65 @@ type PaginationConfig struct {
 	MaxPageSize     int
 }
 
+type CurrencyConfig struct {
+	// Supported lists the ISO-4217 codes orders may be placed in
+	Supported []string
+	// Default is used when an order is created without a currency
+	Default string
+}
+
+type IdempotencyConfig struct {
+	// TTL is how long a stored Idempotency-Key response is replayed
+	TTL time.Duration
+	// SweepInterval is how often expired keys are deleted
+	SweepInterval time.Duration
+	// Lease is how long an unfinished request holds its key
+	Lease time.Duration
+}
+
+type BatchConfig struct {
+	// MaxOrders is the most orders accepted by one batch create request
+	MaxOrders int
+}
+
+type WebhookConfig struct {
+	// Timeout bounds each delivery request
+	Timeout time.Duration
+	// MaxAttempts is how many times a delivery is tried before it is dead
+	MaxAttempts int
+	// RetryBase is the wait after the first failure; it doubles after each
+	// further failure, up to RetryMax
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// PollInterval is how often due deliveries are looked for
+	PollInterval time.Duration
+}
+
+type OutboxConfig struct {
+	// Publisher selects where order events go besides webhook subscriptions:
+	// "log", "file", "http" or empty for nowhere else
+	Publisher string
+	// FilePath is the file events are appended to by the file publisher
+	FilePath string
+	// HTTPURL is the URL events are posted to by the http publisher
+	HTTPURL string
+	// HTTPTimeout bounds each request of the http publisher
+	HTTPTimeout time.Duration
+	// BatchSize is how many events are claimed at a time
+	BatchSize int
+	// RetryBase is the wait after an event first fails to publish; it doubles
+	// after each further failure, up to RetryMax
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// PollInterval is how often unsent events are looked for
+	PollInterval time.Duration
+	// Retention is how long sent events are kept, which is how far back
+	// order streams can resume
+	Retention time.Duration
+	// SweepInterval is how often sent events past Retention are deleted
+	SweepInterval time.Duration
+}
+
 func Load() (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
@@ -54,6 +120,51 @@ func Load() (*Config, error) {
 			DefaultPageSize: getEnvAsInt("DEFAULT_PAGE_SIZE", 10),
 			MaxPageSize:     getEnvAsInt("MAX_PAGE_SIZE", 100),
 		},
+		Currency: CurrencyConfig{
+			Supported: getEnvAsUpperList("SUPPORTED_CURRENCIES", []string{"USD", "EUR", "GBP"}),
+			Default:   strings.ToUpper(getEnv("DEFAULT_CURRENCY", "USD")),
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:           getEnvAsDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+			SweepInterval: getEnvAsDuration("IDEMPOTENCY_SWEEP_INTERVAL", time.Hour),
+			Lease:         getEnvAsDuration("IDEMPOTENCY_LEASE", time.Minute),
+		},
+		Batch: BatchConfig{
+			MaxOrders: getEnvAsInt("BATCH_MAX_ORDERS", 500),
+		},
+		Webhook: WebhookConfig{
+			Timeout:      getEnvAsDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+			MaxAttempts:  getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 8),
+			RetryBase:    getEnvAsDuration("WEBHOOK_RETRY_BASE", 30*time.Second),
+			RetryMax:     getEnvAsDuration("WEBHOOK_RETRY_MAX", time.Hour),
+			PollInterval: getEnvAsDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+		},
+		Outbox: OutboxConfig{
+			Publisher:     strings.ToLower(getEnv("OUTBOX_PUBLISHER", "")),
+			FilePath:      getEnv("OUTBOX_FILE_PATH", "events.ndjson"),
+			HTTPURL:       getEnv("OUTBOX_HTTP_URL", ""),
+			HTTPTimeout:   getEnvAsDuration("OUTBOX_HTTP_TIMEOUT", 10*time.Second),
+			BatchSize:     getEnvAsInt("OUTBOX_BATCH_SIZE", 100),
+			RetryBase:     getEnvAsDuration("OUTBOX_RETRY_BASE", time.Second),
+			RetryMax:      getEnvAsDuration("OUTBOX_RETRY_MAX", 5*time.Minute),
+			PollInterval:  getEnvAsDuration("OUTBOX_POLL_INTERVAL", time.Second),
+			Retention:     getEnvAsDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+			SweepInterval: getEnvAsDuration("OUTBOX_SWEEP_INTERVAL", time.Hour),
+		},
+	}
+
+	if !containsString(cfg.Currency.Supported, cfg.Currency.Default) {
+		return nil, fmt.Errorf("DEFAULT_CURRENCY %s is not in SUPPORTED_CURRENCIES", cfg.Currency.Default)
+	}
+
+	switch cfg.Outbox.Publisher {
+	case "", "log", "file":
+	case "http":
+		if cfg.Outbox.HTTPURL == "" {
+			return nil, fmt.Errorf("OUTBOX_HTTP_URL is required when OUTBOX_PUBLISHER is http")
+		}
+	default:
+		return nil, fmt.Errorf("unknown OUTBOX_PUBLISHER %q", cfg.Outbox.Publisher)
 	}
 
 	return cfg, nil
@@ -80,3 +191,36 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvAsDuration reads a Go duration string such as "24h" or "90s"
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := getEnv(key, "")
+	if value, err := time.ParseDuration(valueStr); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsUpperList reads a comma-separated list, upper-casing each entry
+func getEnvAsUpperList(key string, defaultValue []string) []string {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	var values []string
+	for _, v := range strings.Split(valueStr, ",") {
+		if v = strings.ToUpper(strings.TrimSpace(v)); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// ConflictPolicy decides what an import does with an order whose ID already
+// exists, and whether an item whose ID belongs to another order fails the
+// import
+type ConflictPolicy string
+
+const (
+	ConflictFail      ConflictPolicy = "fail"
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+)
+
+func (p ConflictPolicy) IsValid() bool {
+	switch p {
+	case ConflictFail, ConflictSkip, ConflictOverwrite:
+		return true
+	}
+	return false
+}
+
+type ImportOptions struct {
+	OnConflict ConflictPolicy
+	// DryRun runs the whole import, conflicts included, and rolls it back
+	DryRun bool
+}
+
+type ImportResult struct {
+	Imported    int
+	Skipped     int
+	Overwritten int
+	// RenumberedItems counts imported items given a fresh ID because theirs
+	// belonged to another order
+	RenumberedItems int
+}
+
+// ExportOrders writes every order matching filter, with its items, to w as
+// newline-delimited JSON, oldest first. It returns the number of orders
+// written.
+func ExportOrders(ctx context.Context, db *sql.DB, w io.Writer, filter *models.OrderFilter) (int, error) {
+	encoder := json.NewEncoder(w)
+	exported := 0
+	err := repository.NewPostgresOrderRepository(db).Stream(ctx, filter, true, func(order *models.Order) error {
+		order.ItemCount = nil
+		if err := encoder.Encode(order); err != nil {
+			return fmt.Errorf("failed to write order %d: %w", order.ID, err)
+		}
+		exported++
+		return nil
+	})
+	return exported, err
+}
+
+// ImportOrders loads orders written by ExportOrders, keeping their IDs,
+// versions and timestamps. The import runs in one transaction: any error
+// leaves the database unchanged.
+func ImportOrders(ctx context.Context, db *sql.DB, r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if !opts.OnConflict.IsValid() {
+		return nil, fmt.Errorf("unknown conflict policy %q", opts.OnConflict)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result := &ImportResult{}
+	decoder := json.NewDecoder(r)
+	for record := 1; ; record++ {
+		var order models.Order
+		err := decoder.Decode(&order)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: invalid JSON: %w", record, err)
+		}
+		if err := validateImportedOrder(&order); err != nil {
+			return nil, fmt.Errorf("record %d: %w", record, err)
+		}
+
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM orders WHERE id = $1)", order.ID).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("record %d: failed to check order %d: %w", record, order.ID, err)
+		}
+
+		action, err := resolveConflict(exists, opts.OnConflict)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: order %d %w", record, order.ID, err)
+		}
+		switch action {
+		case importInsert:
+			err = insertImportedOrder(ctx, tx, &order)
+			result.Imported++
+		case importSkip:
+			result.Skipped++
+			continue
+		case importOverwrite:
+			err = overwriteImportedOrder(ctx, tx, &order)
+			result.Overwritten++
+		}
+		if err == nil {
+			var renumbered int
+			renumbered, err = insertImportedItems(ctx, tx, &order, opts.OnConflict)
+			result.RenumberedItems += renumbered
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", record, err)
+		}
+	}
+
+	// setval is not undone by a rollback, so a dry run stops here
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// Explicit IDs bypass the sequences, which must move past them so that
+	// orders created afterwards do not collide. A sequence already ahead of
+	// the imported IDs is left where it is.
+	for _, table := range []string{"orders", "order_items"} {
+		query := fmt.Sprintf(`
+			SELECT setval(seq::regclass, GREATEST((SELECT MAX(id) FROM %[1]s), pg_sequence_last_value(seq::regclass), 1))
+			FROM pg_get_serial_sequence('%[1]s', 'id') AS seq
+		`, table)
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("failed to advance %s id sequence: %w", table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return result, nil
+}
+
+// importAction is what an import does with one record
+type importAction int
+
+const (
+	importInsert importAction = iota
+	importSkip
+	importOverwrite
+)
+
+// errOrderExists is returned by resolveConflict under ConflictFail
+var errOrderExists = errors.New("already exists")
+
+// resolveConflict decides what to do with a record whose order ID exists or
+// not, under policy
+func resolveConflict(exists bool, policy ConflictPolicy) (importAction, error) {
+	switch {
+	case !exists:
+		return importInsert, nil
+	case policy == ConflictSkip:
+		return importSkip, nil
+	case policy == ConflictOverwrite:
+		return importOverwrite, nil
+	}
+	return 0, errOrderExists
+}
+
+// errItemExists is returned by resolveItemConflict under ConflictFail
+var errItemExists = errors.New("already belongs to another order")
+
+// resolveItemConflict decides whether an item whose ID is taken by another
+// order or not is renumbered, under policy. Such an item only shares an ID
+// with the other order's, so skip and overwrite both keep it under a fresh
+// ID rather than dropping it or taking the other order's item.
+func resolveItemConflict(taken bool, policy ConflictPolicy) (bool, error) {
+	switch {
+	case !taken:
+		return false, nil
+	case policy == ConflictFail:
+		return false, errItemExists
+	}
+	return true, nil
+}
+
+// validateImportedOrder checks the fields the schema cannot
+func validateImportedOrder(order *models.Order) error {
+	if order.ID < 1 {
+		return errors.New("id must be a positive integer")
+	}
+	if order.CustomerID == "" {
+		return fmt.Errorf("order %d: customer_id is required", order.ID)
+	}
+	if !models.OrderStatus(order.Status).IsValid() {
+		return fmt.Errorf("order %d: invalid status %q", order.ID, order.Status)
+	}
+	if order.CancellationReason != nil && !models.CancellationReason(*order.CancellationReason).IsValid() {
+		return fmt.Errorf("order %d: invalid cancellation_reason %q", order.ID, *order.CancellationReason)
+	}
+	order.Currency = strings.ToUpper(order.Currency)
+	if len(order.Currency) != 3 {
+		return fmt.Errorf("order %d: currency must be a three-letter code", order.ID)
+	}
+	if order.Version < 1 {
+		order.Version = 1
+	}
+	if order.CreatedAt.IsZero() || order.UpdatedAt.IsZero() {
+		return fmt.Errorf("order %d: created_at and updated_at are required", order.ID)
+	}
+	// Timestamps are stored in UTC without a zone
+	order.CreatedAt = order.CreatedAt.UTC()
+	order.UpdatedAt = order.UpdatedAt.UTC()
+	if order.CancelledAt != nil {
+		cancelledAt := order.CancelledAt.UTC()
+		order.CancelledAt = &cancelledAt
+	}
+	for i, item := range order.Items {
+		if item.ID < 1 || item.ProductID == "" || item.Quantity <= 0 {
+			return fmt.Errorf("order %d: items[%d] needs an id, a product_id and a positive quantity", order.ID, i)
+		}
+	}
+	return nil
+}
+
+func insertImportedOrder(ctx context.Context, tx *sql.Tx, order *models.Order) error {
+	query := `
+		INSERT INTO orders (id, customer_id, total_amount, currency, status, cancellation_reason, cancellation_note, cancelled_at, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	if _, err := tx.ExecContext(ctx, query, importedOrderArgs(order)...); err != nil {
+		return fmt.Errorf("failed to insert order %d: %w", order.ID, err)
+	}
+
+	// History is not exported; record where the order's timeline starts
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO order_status_history (order_id, from_status, to_status, actor, reason, changed_at) VALUES ($1, NULL, $2, 'system', 'imported', $3)`,
+		order.ID, order.Status, order.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert status history for order %d: %w", order.ID, err)
+	}
+	return nil
+}
+
+func overwriteImportedOrder(ctx context.Context, tx *sql.Tx, order *models.Order) error {
+	query := `
+		UPDATE orders
+		SET customer_id = $2, total_amount = $3, currency = $4, status = $5, cancellation_reason = $6,
+			cancellation_note = $7, cancelled_at = $8, version = $9, created_at = $10, updated_at = $11
+		WHERE id = $1
+	`
+	if _, err := tx.ExecContext(ctx, query, importedOrderArgs(order)...); err != nil {
+		return fmt.Errorf("failed to overwrite order %d: %w", order.ID, err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM order_items WHERE order_id = $1", order.ID); err != nil {
+		return fmt.Errorf("failed to replace items of order %d: %w", order.ID, err)
+	}
+	return nil
+}
+
+func importedOrderArgs(order *models.Order) []interface{} {
+	return []interface{}{
+		order.ID, order.CustomerID, order.TotalAmount, order.Currency, order.Status, order.CancellationReason,
+		order.CancellationNote, order.CancelledAt, order.Version, order.CreatedAt, order.UpdatedAt,
+	}
+}
+
+// insertImportedItems inserts the order's items, which it no longer has, and
+// returns how many were renumbered
+func insertImportedItems(ctx context.Context, tx *sql.Tx, order *models.Order, policy ConflictPolicy) (int, error) {
+	renumbered := 0
+	for i := range order.Items {
+		item := &order.Items[i]
+		var taken bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM order_items WHERE id = $1)", item.ID).Scan(&taken); err != nil {
+			return 0, fmt.Errorf("failed to check item %d of order %d: %w", item.ID, order.ID, err)
+		}
+		renumber, err := resolveItemConflict(taken, policy)
+		if err != nil {
+			return 0, fmt.Errorf("item %d of order %d %w", item.ID, order.ID, err)
+		}
+
+		if renumber {
+			// The fresh ID comes from the sequence, as for items created
+			// through the API
+			err = tx.QueryRowContext(ctx,
+				`INSERT INTO order_items (order_id, product_id, quantity, price) VALUES ($1, $2, $3, $4) RETURNING id`,
+				order.ID, item.ProductID, item.Quantity, item.Price,
+			).Scan(&item.ID)
+			renumbered++
+		} else {
+			_, err = tx.ExecContext(ctx,
+				`INSERT INTO order_items (id, order_id, product_id, quantity, price) VALUES ($1, $2, $3, $4, $5)`,
+				item.ID, order.ID, item.ProductID, item.Quantity, item.Price,
+			)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert item %d of order %d: %w", item.ID, order.ID, err)
+		}
+	}
+	return renumbered, nil
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+)
+
+func TestValidateImportedOrder_RoundTrip(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	created := time.Date(2026, 1, 5, 10, 0, 0, 0, berlin)
+	cancelled := created.Add(2 * time.Hour)
+	reason := "fraud"
+	exported := models.Order{
+		ID: 42, CustomerID: "cust-1", TotalAmount: 2500, Currency: "EUR", Status: "cancelled",
+		CancellationReason: &reason, CancellationNote: "chargeback", CancelledAt: &cancelled,
+		Version: 3, CreatedAt: created, UpdatedAt: cancelled,
+		Items: []models.OrderItem{{ID: 7, OrderID: 42, ProductID: "prod-1", Quantity: 5, Price: 500, Currency: "EUR"}},
+	}
+
+	// Written the way ExportOrders writes it
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(exported); err != nil {
+		t.Fatalf("failed to encode order: %v", err)
+	}
+	var imported models.Order
+	if err := json.NewDecoder(&buf).Decode(&imported); err != nil {
+		t.Fatalf("failed to decode order: %v", err)
+	}
+	if err := validateImportedOrder(&imported); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if imported.CreatedAt.Location() != time.UTC || imported.CancelledAt.Location() != time.UTC {
+		t.Errorf("expected timestamps in UTC, got %v and %v", imported.CreatedAt, imported.CancelledAt)
+	}
+	if !imported.CreatedAt.Equal(created) || !imported.UpdatedAt.Equal(cancelled) || !imported.CancelledAt.Equal(cancelled) {
+		t.Errorf("expected timestamps to survive the round trip, got %+v", imported)
+	}
+	if imported.ID != 42 || imported.TotalAmount != 2500 || imported.Currency != "EUR" || imported.Version != 3 ||
+		*imported.CancellationReason != "fraud" || imported.CancellationNote != "chargeback" {
+		t.Errorf("expected the order's fields to survive the round trip, got %+v", imported)
+	}
+	if len(imported.Items) != 1 || imported.Items[0] != exported.Items[0] {
+		t.Errorf("expected the item to survive the round trip, got %+v", imported.Items)
+	}
+}
+
+func TestValidateImportedOrder_Invalid(t *testing.T) {
+	now := time.Now()
+	other := "lost_in_transit"
+	valid := func() models.Order {
+		return models.Order{ID: 1, CustomerID: "cust-1", Currency: "usd", Status: "pending", CreatedAt: now, UpdatedAt: now}
+	}
+	tests := []struct {
+		name   string
+		modify func(*models.Order)
+	}{
+		{"missing id", func(o *models.Order) { o.ID = 0 }},
+		{"missing customer", func(o *models.Order) { o.CustomerID = "" }},
+		{"unknown status", func(o *models.Order) { o.Status = "lost" }},
+		{"unknown cancellation reason", func(o *models.Order) { o.CancellationReason = &other }},
+		{"bad currency", func(o *models.Order) { o.Currency = "EURO" }},
+		{"missing created_at", func(o *models.Order) { o.CreatedAt = time.Time{} }},
+		{"item without product", func(o *models.Order) { o.Items = []models.OrderItem{{ID: 1, Quantity: 1}} }},
+	}
+	for _, tt := range tests {
+		order := valid()
+		tt.modify(&order)
+		if err := validateImportedOrder(&order); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	order := valid()
+	if err := validateImportedOrder(&order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order.Currency != "USD" || order.Version != 1 {
+		t.Errorf("expected currency upper-cased and version defaulted to 1, got %q and %d", order.Currency, order.Version)
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	tests := []struct {
+		exists bool
+		policy ConflictPolicy
+		want   importAction
+		err    error
+	}{
+		{false, ConflictFail, importInsert, nil},
+		{false, ConflictSkip, importInsert, nil},
+		{false, ConflictOverwrite, importInsert, nil},
+		{true, ConflictFail, 0, errOrderExists},
+		{true, ConflictSkip, importSkip, nil},
+		{true, ConflictOverwrite, importOverwrite, nil},
+	}
+	for _, tt := range tests {
+		got, err := resolveConflict(tt.exists, tt.policy)
+		if !errors.Is(err, tt.err) || (err == nil && got != tt.want) {
+			t.Errorf("resolveConflict(%v, %s) = %v, %v; want %v, %v", tt.exists, tt.policy, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestResolveItemConflict(t *testing.T) {
+	tests := []struct {
+		taken  bool
+		policy ConflictPolicy
+		want   bool
+		err    error
+	}{
+		{false, ConflictFail, false, nil},
+		{false, ConflictSkip, false, nil},
+		{false, ConflictOverwrite, false, nil},
+		{true, ConflictFail, false, errItemExists},
+		{true, ConflictSkip, true, nil},
+		{true, ConflictOverwrite, true, nil},
+	}
+	for _, tt := range tests {
+		got, err := resolveItemConflict(tt.taken, tt.policy)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("resolveItemConflict(%v, %s) = %v, %v; want %v, %v", tt.taken, tt.policy, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestConflictPolicy_IsValid(t *testing.T) {
+	for _, policy := range []ConflictPolicy{ConflictFail, ConflictSkip, ConflictOverwrite} {
+		if !policy.IsValid() {
+			t.Errorf("expected %s to be valid", policy)
+		}
+	}
+	if ConflictPolicy("merge").IsValid() {
+		t.Error("expected merge to be invalid")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"math/rand"
 	"time"
+
+	"github.com/sabina/orders-api/internal/models"
 )
 
 var statuses = []string{"pending", "processing", "shipped", "delivered", "cancelled"}
@@ -13,29 +15,49 @@ func SeedOrders(db *sql.DB, n int) error {
 	rand.Seed(time.Now().UnixNano())
 	for i := 0; i < n; i++ {
 		customerID := fmt.Sprintf("cust-%d", rand.Intn(10)+1)
-		totalAmount := rand.Float64()*1000 + 10
 		status := statuses[rand.Intn(len(statuses))]
 		createdAt := time.Now().Add(-time.Duration(rand.Intn(365)) * 24 * time.Hour)
 		updatedAt := createdAt.Add(time.Duration(rand.Intn(10)) * time.Hour)
 
+		// Add 1-5 items per order, priced between 5.00 and 205.00
+		items := make([]models.OrderItem, rand.Intn(5)+1)
+		var totalAmount models.Money
+		for j := range items {
+			items[j] = models.OrderItem{
+				ProductID: fmt.Sprintf("prod-%d", rand.Intn(20)+1),
+				Quantity:  rand.Intn(5) + 1,
+				Price:     models.Money(rand.Intn(20000) + 500),
+			}
+			totalAmount += items[j].Price.Mul(items[j].Quantity)
+		}
+
+		var cancellationReason, cancelledAt interface{}
+		if status == string(models.StatusCancelled) {
+			cancellationReason = string(models.CancellationOther)
+			cancelledAt = updatedAt
+		}
+
 		var orderID int64
 		err := db.QueryRow(
-			`INSERT INTO orders (customer_id, total_amount, status, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING id`,
-			customerID, totalAmount, status, createdAt, updatedAt,
+			`INSERT INTO orders (customer_id, total_amount, status, cancellation_reason, cancelled_at, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+			customerID, totalAmount, status, cancellationReason, cancelledAt, createdAt, updatedAt,
 		).Scan(&orderID)
 		if err != nil {
 			return fmt.Errorf("failed to insert order: %w", err)
 		}
 
-		// Add 1-5 items per order
-		itemCount := rand.Intn(5) + 1
-		for j := 0; j < itemCount; j++ {
-			productID := fmt.Sprintf("prod-%d", rand.Intn(20)+1)
-			quantity := rand.Intn(5) + 1
-			price := rand.Float64()*200 + 5
+		_, err = db.Exec(
+			`INSERT INTO order_status_history (order_id, from_status, to_status, actor, reason, changed_at) VALUES ($1, NULL, $2, 'system', 'seeded', $3)`,
+			orderID, status, createdAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert status history: %w", err)
+		}
+
+		for _, item := range items {
 			_, err := db.Exec(
 				`INSERT INTO order_items (order_id, product_id, quantity, price) VALUES ($1, $2, $3, $4)`,
-				orderID, productID, quantity, price,
+				orderID, item.ProductID, item.Quantity, item.Price,
 			)
 			if err != nil {
 				return fmt.Errorf("failed to insert order item: %w", err)
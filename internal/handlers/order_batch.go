@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/service"
+	"github.com/sabina/orders-api/pkg/response"
+)
+
+// defaultMaxBatchSize caps a batch when WithMaxBatchSize is not used
+const defaultMaxBatchSize = 100
+
+// maxBatchOrderBytes is the body size allowed per order of a batch, so that
+// an oversized batch is rejected before it is read into memory
+const maxBatchOrderBytes = 64 << 10
+
+// batchOrderResult reports what happened to one order of a batch
+type batchOrderResult struct {
+	Index  int                      `json:"index"`
+	Status string                   `json:"status"`
+	ID     int64                    `json:"id,omitempty"`
+	Error  *response.ProblemDetails `json:"error,omitempty"`
+}
+
+// batchCreateResponse lists the outcome of every order of a batch, in the
+// order they were sent
+type batchCreateResponse struct {
+	Mode    models.BatchMode   `json:"mode"`
+	Created int                `json:"created"`
+	Failed  int                `json:"failed"`
+	Results []batchOrderResult `json:"results"`
+}
+
+// WithMaxBatchSize sets how many orders CreateOrders and BulkUpdateStatus
+// accept in one request
+func (h *OrderHandler) WithMaxBatchSize(max int) *OrderHandler {
+	h.maxBatchSize = max
+	return h
+}
+
+func (h *OrderHandler) batchLimit() int {
+	if h.maxBatchSize < 1 {
+		return defaultMaxBatchSize
+	}
+	return h.maxBatchSize
+}
+
+// CreateOrders creates a batch of orders. An atomic batch answers 201 when
+// every order was created; a partial batch answers 201 when every order was
+// created and 207 when some failed, with the reason in each failed result.
+func (h *OrderHandler) CreateOrders(w http.ResponseWriter, r *http.Request) {
+	maxBatchSize := h.batchLimit()
+	body := http.MaxBytesReader(w, r.Body, int64(maxBatchSize+1)*maxBatchOrderBytes)
+	var req models.BatchCreateRequest
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, codeBatchTooLarge,
+				fmt.Sprintf("A batch may contain at most %d orders of %d bytes each", maxBatchSize, maxBatchOrderBytes))
+			return
+		}
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	if len(req.Orders) > maxBatchSize {
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, codeBatchTooLarge,
+			fmt.Sprintf("A batch may contain at most %d orders, got %d", maxBatchSize, len(req.Orders)))
+		return
+	}
+
+	results, err := h.service.CreateOrders(r.Context(), req.Orders, req.Mode)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := batchCreateResponse{Mode: req.Mode, Results: make([]batchOrderResult, len(results))}
+	if resp.Mode == "" {
+		resp.Mode = models.BatchAtomic
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			problem := problemFor(result.Err).WithDefaults(nil)
+			resp.Results[i] = batchOrderResult{Index: result.Index, Status: "failed", Error: &problem}
+			resp.Failed++
+			continue
+		}
+		resp.Results[i] = batchOrderResult{Index: result.Index, Status: "created", ID: result.Order.ID}
+		resp.Created++
+	}
+
+	status := http.StatusCreated
+	if resp.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	response.JSON(w, status, resp)
+}
+
+// bulkStatusResult reports what happened to one order of a bulk status change
+type bulkStatusResult struct {
+	ID      int64                    `json:"id"`
+	Outcome string                   `json:"outcome"`
+	Version int                      `json:"version,omitempty"`
+	Error   *response.ProblemDetails `json:"error,omitempty"`
+}
+
+// bulkStatusResponse summarizes a bulk status change. Results are oldest order
+// first for a filter and in request order for a list of IDs.
+type bulkStatusResponse struct {
+	Status    string             `json:"status"`
+	Matched   int                `json:"matched"`
+	Updated   int                `json:"updated"`
+	Unchanged int                `json:"unchanged"`
+	Failed    int                `json:"failed"`
+	Results   []bulkStatusResult `json:"results"`
+}
+
+// BulkUpdateStatus moves a list of orders, or every order matching the
+// filter query parameters, to a new status. Transition rules are applied to
+// each order separately; the response reports every order's outcome.
+func (h *OrderHandler) BulkUpdateStatus(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var errs queryErrors
+	filter := parseOrderFilter(query, &errs)
+	checkUnknownParams(query, &errs, orderFilterParams)
+	if len(errs) > 0 {
+		writeValidationProblem(w, r, "Invalid query parameters", errs)
+		return
+	}
+
+	var req models.BulkStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+	if req.Status == "" {
+		writeError(w, r, service.NewValidationError("status", "required", "status is required"))
+		return
+	}
+
+	results, err := h.service.BulkTransitionOrders(r.Context(), req.IDs, filter, &req.StatusUpdate, h.batchLimit())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	resp := bulkStatusResponse{Status: req.Status, Matched: len(results), Results: make([]bulkStatusResult, len(results))}
+	for i, result := range results {
+		resp.Results[i] = bulkStatusResult{ID: result.OrderID, Outcome: result.Outcome}
+		switch result.Outcome {
+		case service.BulkOutcomeUpdated:
+			resp.Results[i].Version = result.Order.Version
+			resp.Updated++
+		case service.BulkOutcomeUnchanged:
+			resp.Unchanged++
+		default:
+			problem := problemFor(result.Err).WithDefaults(nil)
+			resp.Results[i].Error = &problem
+			resp.Failed++
+		}
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
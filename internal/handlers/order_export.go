@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+)
+
+// exportParams are understood by the CSV export in addition to the order
+// filters
+var exportParams = []string{"flatten_items"}
+
+var orderCSVHeader = []string{
+	"id", "customer_id", "status", "currency", "total_amount", "item_count",
+	"cancellation_reason", "cancellation_note", "cancelled_at", "version", "created_at", "updated_at",
+}
+
+// itemCSVHeader is appended to orderCSVHeader when items are flattened into
+// one row per item
+var itemCSVHeader = []string{"item_id", "product_id", "quantity", "price"}
+
+// csvFlushEvery is how many orders are written between flushes to the client
+const csvFlushEvery = 100
+
+// ExportOrdersCSV streams every order matching the filters as CSV, oldest
+// first. With flatten_items=true each line item gets its own row, repeating
+// the order's columns.
+func (h *OrderHandler) ExportOrdersCSV(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var errs queryErrors
+	filter := parseOrderFilter(query, &errs)
+	flatten := parseBoolParam(query, "flatten_items", &errs)
+	checkUnknownParams(query, &errs, exportParams, orderFilterParams)
+	if len(errs) > 0 {
+		writeValidationProblem(w, r, "Invalid query parameters", errs)
+		return
+	}
+
+	// A large export takes far longer than the server's write timeout
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Failed to clear write deadline for order export: %v", err)
+	}
+
+	csvWriter := csv.NewWriter(w)
+	started := false
+	start := func() error {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="orders.csv"`)
+		w.WriteHeader(http.StatusOK)
+		started = true
+
+		header := orderCSVHeader
+		if flatten {
+			header = append(header[:len(header):len(header)], itemCSVHeader...)
+		}
+		return csvWriter.Write(header)
+	}
+
+	exported := 0
+	err := h.service.ExportOrders(r.Context(), filter, flatten, func(order *models.Order) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		for _, record := range orderCSVRecords(order, flatten) {
+			if err := csvWriter.Write(record); err != nil {
+				return err
+			}
+		}
+		exported++
+		if exported%csvFlushEvery == 0 {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+			controller.Flush()
+		}
+		return nil
+	})
+	if err != nil && !started {
+		writeError(w, r, err)
+		return
+	}
+	if err != nil {
+		// The status line has been sent; abort the connection so the client
+		// cannot mistake a truncated file for a complete one
+		log.Printf("Order export aborted after %d orders: %v", exported, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if !started {
+		if err := start(); err != nil {
+			log.Printf("Failed to write order export: %v", err)
+			return
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		log.Printf("Failed to write order export: %v", err)
+	}
+}
+
+// orderCSVRecords renders an order as one CSV record, or one per line item
+// when flattening; an order without items still gets a row
+func orderCSVRecords(order *models.Order, flatten bool) [][]string {
+	itemCount := ""
+	if order.ItemCount != nil {
+		itemCount = strconv.Itoa(*order.ItemCount)
+	}
+	cancellationReason := ""
+	if order.CancellationReason != nil {
+		cancellationReason = *order.CancellationReason
+	}
+	cancelledAt := ""
+	if order.CancelledAt != nil {
+		cancelledAt = order.CancelledAt.Format(time.RFC3339)
+	}
+
+	base := []string{
+		strconv.FormatInt(order.ID, 10),
+		csvText(order.CustomerID),
+		order.Status,
+		order.Currency,
+		order.TotalAmount.String(),
+		itemCount,
+		cancellationReason,
+		csvText(order.CancellationNote),
+		cancelledAt,
+		strconv.Itoa(order.Version),
+		order.CreatedAt.Format(time.RFC3339),
+		order.UpdatedAt.Format(time.RFC3339),
+	}
+	if !flatten {
+		return [][]string{base}
+	}
+	if len(order.Items) == 0 {
+		return [][]string{append(base, "", "", "", "")}
+	}
+
+	records := make([][]string, 0, len(order.Items))
+	for _, item := range order.Items {
+		records = append(records, append(base[:len(base):len(base)],
+			strconv.FormatInt(item.ID, 10),
+			csvText(item.ProductID),
+			strconv.Itoa(item.Quantity),
+			item.Price.String(),
+		))
+	}
+	return records
+}
+
+// csvText neutralizes client-supplied text that a spreadsheet would otherwise
+// evaluate as a formula
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
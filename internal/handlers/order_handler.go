@@ -1,106 +1,297 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
-	"time"
+	"strings"
 
+	"github.com/gorilla/mux"
 	"github.com/sabina/orders-api/internal/models"
 	"github.com/sabina/orders-api/internal/service"
 	"github.com/sabina/orders-api/pkg/response"
 )
 
+// idempotencyKeyHeader lets clients retry CreateOrder safely
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength matches the idempotency_keys.key column
+const maxIdempotencyKeyLength = 255
+
 type OrderHandler struct {
 	service         service.OrderServiceInterface
+	idempotency     service.IdempotencyServiceInterface
+	stream          service.OrderStreamInterface
 	maxPageSize     int
 	defaultPageSize int
+	maxBatchSize    int
 }
 
 func NewOrderHandler(service service.OrderServiceInterface, defaultPageSize, maxPageSize int) *OrderHandler {
 	return &OrderHandler{
-		service:       service,
+		service:         service,
 		defaultPageSize: defaultPageSize,
-		maxPageSize:   maxPageSize,
+		maxPageSize:     maxPageSize,
 	}
 }
 
+// WithIdempotency enables Idempotency-Key handling on CreateOrder
+func (h *OrderHandler) WithIdempotency(idempotency service.IdempotencyServiceInterface) *OrderHandler {
+	h.idempotency = idempotency
+	return h
+}
+
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
 	var order models.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		response.Error(w, http.StatusBadRequest, "Invalid request body")
+	if err := json.Unmarshal(body, &order); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	reservation, handled := h.beginIdempotentRequest(w, r, body)
+	if handled {
 		return
 	}
 
 	if err := h.service.CreateOrder(r.Context(), &order); err != nil {
-		response.Error(w, http.StatusBadRequest, err.Error())
+		h.releaseIdempotencyKey(r, reservation)
+		writeError(w, r, err)
 		return
 	}
 
-	response.JSON(w, http.StatusCreated, order)
+	payload, err := json.Marshal(order)
+	if err != nil {
+		h.releaseIdempotencyKey(r, reservation)
+		writeError(w, r, err)
+		return
+	}
+	if reservation != nil {
+		if err := h.idempotency.Complete(context.WithoutCancel(r.Context()), reservation, http.StatusCreated, payload); err != nil {
+			// A retry would no longer be recognised once the key's lease is
+			// over, so the client has to learn which order was created
+			log.Printf("Failed to store response for idempotency key %q of order %d: %v", reservation.Key, order.ID, err)
+			response.Problem(w, r, response.ProblemDetails{
+				Status:     http.StatusInternalServerError,
+				Code:       codeIdempotencyNotRecorded,
+				Detail:     fmt.Sprintf("Order %d was created but the response for its Idempotency-Key could not be stored", order.ID),
+				Extensions: map[string]interface{}{"order_id": order.ID},
+			})
+			return
+		}
+	}
+
+	w.Header().Set("ETag", orderETag(&order))
+	response.RawJSON(w, http.StatusCreated, payload)
 }
 
-func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
-	// Parse pagination
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
+// beginIdempotentRequest reserves the request's Idempotency-Key, if any. It
+// returns the reservation, or handled=true when a response has already been
+// written: a replay of the original response or an error.
+func (h *OrderHandler) beginIdempotentRequest(w http.ResponseWriter, r *http.Request, body []byte) (*models.IdempotencyRecord, bool) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" || h.idempotency == nil {
+		return nil, false
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		writeProblem(w, r, http.StatusBadRequest, codeIdempotencyKeyTooLong, "Idempotency-Key must be at most 255 characters")
+		return nil, true
 	}
 
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit < 1 {
-		limit = h.defaultPageSize
+	record, err := h.idempotency.Begin(r.Context(), key, body)
+	switch {
+	case err != nil:
+		writeError(w, r, err)
+		return nil, true
+	case record.Completed():
+		w.Header().Set("Idempotent-Replayed", "true")
+		var order models.Order
+		if record.ResponseStatus == http.StatusCreated && json.Unmarshal(record.ResponseBody, &order) == nil {
+			// The order's version when it was created, as in the original
+			// response
+			w.Header().Set("ETag", orderETag(&order))
+		}
+		response.RawJSON(w, record.ResponseStatus, record.ResponseBody)
+		return nil, true
 	}
-	if limit > h.maxPageSize {
-		limit = h.maxPageSize
+	return record, false
+}
+
+// releaseIdempotencyKey frees a reserved key after a failed request so the
+// client can retry it
+func (h *OrderHandler) releaseIdempotencyKey(r *http.Request, reservation *models.IdempotencyRecord) {
+	if reservation == nil {
+		return
 	}
+	if err := h.idempotency.Release(context.WithoutCancel(r.Context()), reservation); err != nil {
+		log.Printf("Failed to release idempotency key %q: %v", reservation.Key, err)
+	}
+}
 
-	pagination := &models.Pagination{
-		Page:  page,
-		Limit: limit,
+func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseOrderID(w, r)
+	if !ok {
+		return
 	}
 
-	// Parse filters
-	filter := &models.OrderFilter{}
-	
-	if customerID := r.URL.Query().Get("customer_id"); customerID != "" {
-		filter.CustomerID = &customerID
+	order, err := h.service.GetOrder(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	
-	if status := r.URL.Query().Get("status"); status != "" {
-		filter.Status = &status
+
+	w.Header().Set("ETag", orderETag(order))
+	response.JSON(w, http.StatusOK, order)
+}
+
+func (h *OrderHandler) TransitionOrder(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseOrderID(w, r)
+	if !ok {
+		return
 	}
-	
-	if minAmountStr := r.URL.Query().Get("min_amount"); minAmountStr != "" {
-		if minAmount, err := strconv.ParseFloat(minAmountStr, 64); err == nil {
-			filter.MinAmount = &minAmount
-		}
+	expectedVersion, ok := parseIfMatch(w, r)
+	if !ok {
+		return
 	}
-	
-	if maxAmountStr := r.URL.Query().Get("max_amount"); maxAmountStr != "" {
-		if maxAmount, err := strconv.ParseFloat(maxAmountStr, 64); err == nil {
-			filter.MaxAmount = &maxAmount
-		}
+
+	var update models.StatusUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
 	}
-	
-	if fromDateStr := r.URL.Query().Get("from_date"); fromDateStr != "" {
-		if fromDate, err := time.Parse("2006-01-02", fromDateStr); err == nil {
-			filter.FromDate = &fromDate
-		}
+	if update.Status == "" {
+		writeError(w, r, service.NewValidationError("status", "required", "status is required"))
+		return
 	}
-	
-	if toDateStr := r.URL.Query().Get("to_date"); toDateStr != "" {
-		if toDate, err := time.Parse("2006-01-02", toDateStr); err == nil {
-			filter.ToDate = &toDate
-		}
+	update.ExpectedVersion = expectedVersion
+
+	order, err := h.service.TransitionOrder(r.Context(), id, &update)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", orderETag(order))
+	response.JSON(w, http.StatusOK, order)
+}
+
+func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseOrderID(w, r)
+	if !ok {
+		return
+	}
+	expectedVersion, ok := parseIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CancelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	req.ExpectedVersion = expectedVersion
+
+	order, err := h.service.CancelOrder(r.Context(), id, &req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", orderETag(order))
+	response.JSON(w, http.StatusOK, order)
+}
+
+// orderHistoryResponse wraps an order's status timeline
+type orderHistoryResponse struct {
+	OrderID int64                       `json:"order_id"`
+	History []models.StatusHistoryEntry `json:"history"`
+}
+
+func (h *OrderHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	history, err := h.service.GetOrderHistory(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, orderHistoryResponse{OrderID: id, History: history})
+}
+
+func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var errs queryErrors
+	pagination := h.parsePagination(query, &errs)
+	filter := parseOrderFilter(query, &errs)
+	checkUnknownParams(query, &errs, paginationParams, orderFilterParams)
+	if len(errs) > 0 {
+		writeValidationProblem(w, r, "Invalid query parameters", errs)
+		return
 	}
 
 	result, err := h.service.ListOrders(r.Context(), filter, pagination)
 	if err != nil {
-		response.Error(w, http.StatusInternalServerError, err.Error())
+		writeError(w, r, err)
 		return
 	}
 
 	response.JSON(w, http.StatusOK, result)
 }
 
+// parseOrderID reads the {id} route variable, writing a 400 response when it
+// is not a positive integer
+func parseOrderID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id < 1 {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidOrderID, "Invalid order ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// orderETag is the strong entity tag for an order's current version
+func orderETag(order *models.Order) string {
+	return strconv.Quote(strconv.Itoa(order.Version))
+}
+
+// parseIfMatch reads the version a mutating request expects from If-Match.
+// The header is required; "*" matches any version and yields nil. A tag that
+// cannot be one of our ETags can never match, so it fails with 412.
+func parseIfMatch(w http.ResponseWriter, r *http.Request) (*int, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		writeProblem(w, r, http.StatusPreconditionRequired, codeIfMatchRequired, "If-Match header with the order's ETag is required")
+		return nil, false
+	}
+	if header == "*" {
+		return nil, true
+	}
+
+	tag, err := strconv.Unquote(header)
+	if err != nil {
+		writeProblem(w, r, http.StatusPreconditionFailed, service.ErrVersionConflict.Code, "If-Match does not match the order's current ETag")
+		return nil, false
+	}
+	version, err := strconv.Atoi(tag)
+	if err != nil {
+		writeProblem(w, r, http.StatusPreconditionFailed, service.ErrVersionConflict.Code, "If-Match does not match the order's current ETag")
+		return nil, false
+	}
+	return &version, true
+}
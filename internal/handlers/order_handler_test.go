@@ -7,23 +7,79 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/sabina/orders-api/internal/models"
+	svc "github.com/sabina/orders-api/internal/service"
+	"github.com/sabina/orders-api/pkg/response"
 )
 
 type mockOrderService struct {
 	CreateOrderFunc func(ctx context.Context, order *models.Order) error
+	CreateBatchFunc func(ctx context.Context, orders []models.Order, mode models.BatchMode) ([]svc.BatchOrderResult, error)
+	BulkStatusFunc  func(ctx context.Context, ids []int64, filter *models.OrderFilter, update *models.StatusUpdate, limit int) ([]svc.BulkStatusResult, error)
+	GetOrderFunc    func(ctx context.Context, id int64) (*models.Order, error)
+	TransitionFunc  func(ctx context.Context, id int64, update *models.StatusUpdate) (*models.Order, error)
+	CancelFunc      func(ctx context.Context, id int64, req *models.CancelRequest) (*models.Order, error)
+	HistoryFunc     func(ctx context.Context, id int64) ([]models.StatusHistoryEntry, error)
 	ListOrdersFunc  func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error)
+	ExportFunc      func(ctx context.Context, filter *models.OrderFilter, includeItems bool, fn func(*models.Order) error) error
 }
 
 func (m *mockOrderService) CreateOrder(ctx context.Context, order *models.Order) error {
 	return m.CreateOrderFunc(ctx, order)
 }
+func (m *mockOrderService) CreateOrders(ctx context.Context, orders []models.Order, mode models.BatchMode) ([]svc.BatchOrderResult, error) {
+	return m.CreateBatchFunc(ctx, orders, mode)
+}
+func (m *mockOrderService) BulkTransitionOrders(ctx context.Context, ids []int64, filter *models.OrderFilter, update *models.StatusUpdate, limit int) ([]svc.BulkStatusResult, error) {
+	return m.BulkStatusFunc(ctx, ids, filter, update, limit)
+}
+func (m *mockOrderService) GetOrder(ctx context.Context, id int64) (*models.Order, error) {
+	return m.GetOrderFunc(ctx, id)
+}
+func (m *mockOrderService) TransitionOrder(ctx context.Context, id int64, update *models.StatusUpdate) (*models.Order, error) {
+	return m.TransitionFunc(ctx, id, update)
+}
+func (m *mockOrderService) CancelOrder(ctx context.Context, id int64, req *models.CancelRequest) (*models.Order, error) {
+	return m.CancelFunc(ctx, id, req)
+}
+func (m *mockOrderService) GetOrderHistory(ctx context.Context, id int64) ([]models.StatusHistoryEntry, error) {
+	return m.HistoryFunc(ctx, id)
+}
 func (m *mockOrderService) ListOrders(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
 	return m.ListOrdersFunc(ctx, filter, pagination)
 }
+func (m *mockOrderService) ExportOrders(ctx context.Context, filter *models.OrderFilter, includeItems bool, fn func(*models.Order) error) error {
+	return m.ExportFunc(ctx, filter, includeItems, fn)
+}
+
+type mockOrderStream struct {
+	StreamFunc func(ctx context.Context, filter *models.OrderFilter, position *models.StreamPosition, fn func(*models.OrderChange) error) error
+}
+
+func (m *mockOrderStream) StreamOrderChanges(ctx context.Context, filter *models.OrderFilter, position *models.StreamPosition, fn func(*models.OrderChange) error) error {
+	return m.StreamFunc(ctx, filter, position, fn)
+}
+
+type mockIdempotencyService struct {
+	BeginFunc    func(ctx context.Context, key string, body []byte) (*models.IdempotencyRecord, error)
+	CompleteFunc func(ctx context.Context, reservation *models.IdempotencyRecord, status int, body []byte) error
+	ReleaseFunc  func(ctx context.Context, reservation *models.IdempotencyRecord) error
+}
+
+func (m *mockIdempotencyService) Begin(ctx context.Context, key string, body []byte) (*models.IdempotencyRecord, error) {
+	return m.BeginFunc(ctx, key, body)
+}
+func (m *mockIdempotencyService) Complete(ctx context.Context, reservation *models.IdempotencyRecord, status int, body []byte) error {
+	return m.CompleteFunc(ctx, reservation, status, body)
+}
+func (m *mockIdempotencyService) Release(ctx context.Context, reservation *models.IdempotencyRecord) error {
+	return m.ReleaseFunc(ctx, reservation)
+}
 
 func setupTestHandler() *OrderHandler {
 	service := &mockOrderService{
@@ -38,7 +94,7 @@ func setupTestHandler() *OrderHandler {
 // 1. Test valid order creation
 func TestCreateOrder_Valid(t *testing.T) {
 	h := setupTestHandler()
-	order := models.Order{CustomerID: "cust-1", TotalAmount: 100.50, Status: "pending"}
+	order := models.Order{CustomerID: "cust-1", TotalAmount: 10050, Status: "pending"}
 	body, _ := json.Marshal(order)
 	req := httptest.NewRequest("POST", "/api/v1/orders", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
@@ -52,6 +108,9 @@ func TestCreateOrder_Valid(t *testing.T) {
 	if response.CustomerID != "cust-1" {
 		t.Errorf("expected customer_id cust-1, got %s", response.CustomerID)
 	}
+	if etag := w.Header().Get("ETag"); etag != orderETag(&response) {
+		t.Errorf("expected ETag %s, got %s", orderETag(&response), etag)
+	}
 }
 
 // 2. Test invalid JSON body
@@ -70,11 +129,11 @@ func TestCreateOrder_InvalidBody(t *testing.T) {
 func TestCreateOrder_ValidationError(t *testing.T) {
 	service := &mockOrderService{
 		CreateOrderFunc: func(ctx context.Context, order *models.Order) error {
-			return errors.New("customer_id is required")
+			return svc.NewValidationError("customer_id", "required", "customer_id is required")
 		},
 	}
 	h := NewOrderHandler(service, 10, 100)
-	order := models.Order{TotalAmount: 100, Status: "pending"}
+	order := models.Order{TotalAmount: 10000, Status: "pending"}
 	body, _ := json.Marshal(order)
 	req := httptest.NewRequest("POST", "/api/v1/orders", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
@@ -138,7 +197,7 @@ func TestListOrders_PaginationExceedsMax(t *testing.T) {
 func TestListOrders_StatusFilter(t *testing.T) {
 	service := &mockOrderService{
 		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
-			if filter.Status == nil || *filter.Status != "shipped" {
+			if len(filter.Statuses) != 1 || filter.Statuses[0] != "shipped" {
 				t.Error("expected status filter 'shipped'")
 			}
 			return &models.PaginatedOrders{Orders: []models.Order{}, Total: 0, Page: 1, Limit: 10, TotalPages: 1}, nil
@@ -157,7 +216,7 @@ func TestListOrders_StatusFilter(t *testing.T) {
 func TestListOrders_CustomerIDFilter(t *testing.T) {
 	service := &mockOrderService{
 		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
-			if filter.CustomerID == nil || *filter.CustomerID != "cust-123" {
+			if len(filter.CustomerIDs) != 1 || filter.CustomerIDs[0] != "cust-123" {
 				t.Error("expected customer_id filter 'cust-123'")
 			}
 			return &models.PaginatedOrders{Orders: []models.Order{}, Total: 0, Page: 1, Limit: 10, TotalPages: 1}, nil
@@ -176,11 +235,11 @@ func TestListOrders_CustomerIDFilter(t *testing.T) {
 func TestListOrders_AmountRange(t *testing.T) {
 	service := &mockOrderService{
 		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
-			if filter.MinAmount == nil || *filter.MinAmount != 50.0 {
-				t.Error("expected min_amount 50.0")
+			if filter.MinAmount == nil || *filter.MinAmount != 5000 {
+				t.Error("expected min_amount 50.00")
 			}
-			if filter.MaxAmount == nil || *filter.MaxAmount != 200.0 {
-				t.Error("expected max_amount 200.0")
+			if filter.MaxAmount == nil || *filter.MaxAmount != 20000 {
+				t.Error("expected max_amount 200.00")
 			}
 			return &models.PaginatedOrders{Orders: []models.Order{}, Total: 0, Page: 1, Limit: 10, TotalPages: 1}, nil
 		},
@@ -224,7 +283,7 @@ func TestListOrders_AllFilters(t *testing.T) {
 	to := time.Now().Format("2006-01-02")
 	service := &mockOrderService{
 		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
-			if filter.Status == nil || *filter.Status != "delivered" {
+			if len(filter.Statuses) != 1 || filter.Statuses[0] != "delivered" {
 				t.Error("expected status 'delivered'")
 			}
 			if filter.MinAmount == nil || filter.MaxAmount == nil {
@@ -245,41 +304,37 @@ func TestListOrders_AllFilters(t *testing.T) {
 	}
 }
 
-// 12. Test invalid min_amount (should be ignored)
+// 12. Test invalid min_amount is rejected
 func TestListOrders_InvalidMinAmount(t *testing.T) {
 	service := &mockOrderService{
 		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
-			if filter.MinAmount != nil {
-				t.Error("expected min_amount to be nil when invalid")
-			}
-			return &models.PaginatedOrders{Orders: []models.Order{}, Total: 0, Page: 1, Limit: 10, TotalPages: 1}, nil
+			t.Error("service should not be called with an invalid min_amount")
+			return nil, nil
 		},
 	}
 	h := NewOrderHandler(service, 10, 100)
 	req := httptest.NewRequest("GET", "/api/v1/orders?min_amount=notanumber", nil)
 	w := httptest.NewRecorder()
 	h.ListOrders(w, req)
-	if w.Code != http.StatusOK {
-		t.Errorf("expected 200, got %d", w.Code)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
 	}
 }
 
-// 13. Test invalid date format (should be ignored)
+// 13. Test invalid date format is rejected
 func TestListOrders_InvalidFromDate(t *testing.T) {
 	service := &mockOrderService{
 		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
-			if filter.FromDate != nil {
-				t.Error("expected from_date to be nil when invalid")
-			}
-			return &models.PaginatedOrders{Orders: []models.Order{}, Total: 0, Page: 1, Limit: 10, TotalPages: 1}, nil
+			t.Error("service should not be called with an invalid from_date")
+			return nil, nil
 		},
 	}
 	h := NewOrderHandler(service, 10, 100)
-	req := httptest.NewRequest("GET", "/api/v1/orders?from_date=bad-date", nil)
+	req := httptest.NewRequest("GET", "/api/v1/orders?from_date=2026/01/01", nil)
 	w := httptest.NewRecorder()
 	h.ListOrders(w, req)
-	if w.Code != http.StatusOK {
-		t.Errorf("expected 200, got %d", w.Code)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
 	}
 }
 
@@ -299,24 +354,1147 @@ func TestListOrders_ServiceError(t *testing.T) {
 	}
 }
 
-// 15. Test zero/negative pagination (should use defaults)
+// 15. Test zero/negative pagination is rejected
 func TestListOrders_NegativePagination(t *testing.T) {
+	h := setupTestHandler()
+	req := httptest.NewRequest("GET", "/api/v1/orders?page=-1&limit=0", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	var body response.ProblemDetails
+	json.NewDecoder(w.Body).Decode(&body)
+	if len(body.Errors) != 2 {
+		t.Errorf("expected errors for page and limit, got %+v", body.Errors)
+	}
+}
+
+// 16. Test get order by ID
+func TestGetOrder_Found(t *testing.T) {
+	service := &mockOrderService{
+		GetOrderFunc: func(ctx context.Context, id int64) (*models.Order, error) {
+			if id != 42 {
+				t.Errorf("expected id 42, got %d", id)
+			}
+			return &models.Order{
+				ID:         42,
+				CustomerID: "cust-1",
+				Status:     "pending",
+				Items:      []models.OrderItem{{ID: 1, OrderID: 42, ProductID: "prod-1", Quantity: 2, Price: 1000}},
+			}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders/42", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "42"})
+	w := httptest.NewRecorder()
+	h.GetOrder(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+	var response models.Order
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.ID != 42 || len(response.Items) != 1 {
+		t.Errorf("expected order 42 with 1 item, got id=%d items=%d", response.ID, len(response.Items))
+	}
+}
+
+// 17. Test get unknown order returns 404
+func TestGetOrder_NotFound(t *testing.T) {
+	service := &mockOrderService{
+		GetOrderFunc: func(ctx context.Context, id int64) (*models.Order, error) {
+			return nil, svc.ErrOrderNotFound
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders/999", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "999"})
+	w := httptest.NewRecorder()
+	h.GetOrder(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+// 18. Test non-numeric order ID returns 400
+func TestGetOrder_InvalidID(t *testing.T) {
+	service := &mockOrderService{
+		GetOrderFunc: func(ctx context.Context, id int64) (*models.Order, error) {
+			t.Error("service should not be called for an invalid id")
+			return nil, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders/abc", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "abc"})
+	w := httptest.NewRecorder()
+	h.GetOrder(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+// 19. Test allowed status transition
+func TestTransitionOrder_Valid(t *testing.T) {
+	service := &mockOrderService{
+		TransitionFunc: func(ctx context.Context, id int64, update *models.StatusUpdate) (*models.Order, error) {
+			if id != 7 || update.Status != "processing" {
+				t.Errorf("expected id 7 to processing, got id=%d status=%s", id, update.Status)
+			}
+			return &models.Order{ID: 7, Status: update.Status}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("POST", "/api/v1/orders/7/transitions", strings.NewReader(`{"status":"processing"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "7"})
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	h.TransitionOrder(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+// 20. Test rejected status transition reports allowed next states
+func TestTransitionOrder_Conflict(t *testing.T) {
+	service := &mockOrderService{
+		TransitionFunc: func(ctx context.Context, id int64, update *models.StatusUpdate) (*models.Order, error) {
+			return nil, svc.ErrInvalidTransition.Wrap(&svc.TransitionError{
+				From:    models.StatusShipped,
+				To:      models.StatusPending,
+				Allowed: []models.OrderStatus{models.StatusDelivered},
+			})
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("POST", "/api/v1/orders/7/transitions", strings.NewReader(`{"status":"pending"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "7"})
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	h.TransitionOrder(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", w.Code)
+	}
+	var body struct {
+		Code               string               `json:"code"`
+		CurrentStatus      models.OrderStatus   `json:"current_status"`
+		AllowedTransitions []models.OrderStatus `json:"allowed_transitions"`
+	}
+	json.NewDecoder(w.Body).Decode(&body)
+	if body.Code != "invalid_transition" || body.CurrentStatus != models.StatusShipped {
+		t.Errorf("expected invalid_transition from shipped, got %q from %q", body.Code, body.CurrentStatus)
+	}
+	if len(body.AllowedTransitions) != 1 || body.AllowedTransitions[0] != models.StatusDelivered {
+		t.Errorf("expected allowed transitions [delivered], got %v", body.AllowedTransitions)
+	}
+}
+
+// 21. Test transition without a target status
+func TestTransitionOrder_MissingStatus(t *testing.T) {
+	h := setupTestHandler()
+	req := httptest.NewRequest("POST", "/api/v1/orders/7/transitions", strings.NewReader(`{}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "7"})
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	h.TransitionOrder(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+// 22. Test order status history
+func TestGetOrderHistory(t *testing.T) {
+	pending := "pending"
+	service := &mockOrderService{
+		HistoryFunc: func(ctx context.Context, id int64) ([]models.StatusHistoryEntry, error) {
+			return []models.StatusHistoryEntry{
+				{ID: 1, OrderID: id, ToStatus: "pending", Actor: "system", Reason: "order created"},
+				{ID: 2, OrderID: id, FromStatus: &pending, ToStatus: "processing", Actor: "warehouse"},
+			}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders/3/history", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "3"})
+	w := httptest.NewRecorder()
+	h.GetOrderHistory(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+	var body orderHistoryResponse
+	json.NewDecoder(w.Body).Decode(&body)
+	if body.OrderID != 3 || len(body.History) != 2 {
+		t.Errorf("expected 2 entries for order 3, got order=%d entries=%d", body.OrderID, len(body.History))
+	}
+	if body.History[0].FromStatus != nil {
+		t.Error("expected first entry to have no from_status")
+	}
+}
+
+// 23. Test history of unknown order returns 404
+func TestGetOrderHistory_NotFound(t *testing.T) {
+	service := &mockOrderService{
+		HistoryFunc: func(ctx context.Context, id int64) ([]models.StatusHistoryEntry, error) {
+			return nil, svc.ErrOrderNotFound
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders/3/history", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "3"})
+	w := httptest.NewRecorder()
+	h.GetOrderHistory(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+// 24. Test cancelling an order
+func TestCancelOrder_Valid(t *testing.T) {
+	service := &mockOrderService{
+		CancelFunc: func(ctx context.Context, id int64, req *models.CancelRequest) (*models.Order, error) {
+			if req.ReasonCode != "out_of_stock" || req.Note != "supplier delay" {
+				t.Errorf("unexpected cancel request %+v", req)
+			}
+			reason := req.ReasonCode
+			return &models.Order{ID: id, Status: "cancelled", CancellationReason: &reason}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("POST", "/api/v1/orders/5/cancel", strings.NewReader(`{"reason_code":"out_of_stock","note":"supplier delay"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "5"})
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	h.CancelOrder(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+// 25. Test cancelling a shipped order returns 409
+func TestCancelOrder_AlreadyShipped(t *testing.T) {
+	service := &mockOrderService{
+		CancelFunc: func(ctx context.Context, id int64, req *models.CancelRequest) (*models.Order, error) {
+			return nil, svc.ErrInvalidTransition.Wrap(&svc.TransitionError{From: models.StatusShipped, To: models.StatusCancelled, Allowed: []models.OrderStatus{models.StatusDelivered}})
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("POST", "/api/v1/orders/5/cancel", strings.NewReader(`{"reason_code":"customer_request"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "5"})
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	h.CancelOrder(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", w.Code)
+	}
+}
+
+// 26. Test unknown cancellation reason returns 400
+func TestCancelOrder_InvalidReason(t *testing.T) {
+	service := &mockOrderService{
+		CancelFunc: func(ctx context.Context, id int64, req *models.CancelRequest) (*models.Order, error) {
+			return nil, svc.ErrInvalidCancellationReason
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("POST", "/api/v1/orders/5/cancel", strings.NewReader(`{"reason_code":"bored"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "5"})
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	h.CancelOrder(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+// 27. Test cancellation reason filter
+func TestListOrders_CancellationReasonFilter(t *testing.T) {
 	service := &mockOrderService{
 		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
-			if pagination.Page != 1 {
-				t.Errorf("expected page to default to 1, got %d", pagination.Page)
+			if filter.CancellationReason == nil || *filter.CancellationReason != "fraud" {
+				t.Error("expected cancellation_reason filter 'fraud'")
 			}
-			if pagination.Limit != 10 {
-				t.Errorf("expected limit to default to 10, got %d", pagination.Limit)
+			return &models.PaginatedOrders{Orders: []models.Order{}, Total: 0, Page: 1, Limit: 10, TotalPages: 1}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders?cancellation_reason=fraud", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+// 28. Test total mismatch returns 422
+func TestCreateOrder_TotalMismatch(t *testing.T) {
+	service := &mockOrderService{
+		CreateOrderFunc: func(ctx context.Context, order *models.Order) error {
+			return svc.ErrTotalMismatch.Wrap(&svc.TotalMismatchError{Declared: 100, Computed: 50000})
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	body := `{"customer_id":"cust-1","total_amount":1,"items":[{"product_id":"prod-1","quantity":5,"price":100}]}`
+	req := httptest.NewRequest("POST", "/api/v1/orders", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.CreateOrder(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", w.Code)
+	}
+}
+
+// 29. Test currency filter
+func TestListOrders_CurrencyFilter(t *testing.T) {
+	service := &mockOrderService{
+		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
+			if filter.Currency == nil || *filter.Currency != "EUR" {
+				t.Error("expected currency filter 'EUR'")
 			}
 			return &models.PaginatedOrders{Orders: []models.Order{}, Total: 0, Page: 1, Limit: 10, TotalPages: 1}, nil
 		},
 	}
 	h := NewOrderHandler(service, 10, 100)
-	req := httptest.NewRequest("GET", "/api/v1/orders?page=-1&limit=0", nil)
+	req := httptest.NewRequest("GET", "/api/v1/orders?currency=EUR&min_amount=10", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+// 30. Test amount filter without currency across currencies returns 400
+func TestListOrders_AmountWithoutCurrency(t *testing.T) {
+	service := &mockOrderService{
+		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
+			return nil, svc.ErrCurrencyRequired
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders?min_amount=10", nil)
 	w := httptest.NewRecorder()
 	h.ListOrders(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+// 31. Test first request with Idempotency-Key stores the response
+func TestCreateOrder_IdempotencyKeyStored(t *testing.T) {
+	var stored []byte
+	idempotency := &mockIdempotencyService{
+		BeginFunc: func(ctx context.Context, key string, body []byte) (*models.IdempotencyRecord, error) {
+			if key != "key-1" {
+				t.Errorf("expected key-1, got %s", key)
+			}
+			return &models.IdempotencyRecord{Key: key}, nil
+		},
+		CompleteFunc: func(ctx context.Context, reservation *models.IdempotencyRecord, status int, body []byte) error {
+			if status != http.StatusCreated {
+				t.Errorf("expected stored status 201, got %d", status)
+			}
+			stored = body
+			return nil
+		},
+	}
+	h := setupTestHandler().WithIdempotency(idempotency)
+	req := httptest.NewRequest("POST", "/api/v1/orders", strings.NewReader(`{"customer_id":"cust-1"}`))
+	req.Header.Set("Idempotency-Key", "key-1")
+	w := httptest.NewRecorder()
+	h.CreateOrder(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", w.Code)
+	}
+	if !bytes.Equal(stored, w.Body.Bytes()) {
+		t.Errorf("expected stored body %s to equal response %s", stored, w.Body.Bytes())
+	}
+}
+
+// 32. Test identical retry replays the stored response
+func TestCreateOrder_IdempotencyReplay(t *testing.T) {
+	idempotency := &mockIdempotencyService{
+		BeginFunc: func(ctx context.Context, key string, body []byte) (*models.IdempotencyRecord, error) {
+			return &models.IdempotencyRecord{Key: key, ResponseStatus: http.StatusCreated, ResponseBody: []byte(`{"id":9,"version":1}`)}, nil
+		},
+	}
+	service := &mockOrderService{
+		CreateOrderFunc: func(ctx context.Context, order *models.Order) error {
+			t.Error("service should not be called for a replayed request")
+			return nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100).WithIdempotency(idempotency)
+	req := httptest.NewRequest("POST", "/api/v1/orders", strings.NewReader(`{"customer_id":"cust-1"}`))
+	req.Header.Set("Idempotency-Key", "key-1")
+	w := httptest.NewRecorder()
+	h.CreateOrder(w, req)
+	if w.Code != http.StatusCreated || w.Body.String() != `{"id":9,"version":1}` {
+		t.Errorf("expected replayed 201 {\"id\":9,\"version\":1}, got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("expected Idempotent-Replayed header")
+	}
+	if etag := w.Header().Get("ETag"); etag != `"1"` {
+		t.Errorf("expected ETag \"1\", got %s", etag)
+	}
+}
+
+// 33. Test key reused with a different body returns 422
+func TestCreateOrder_IdempotencyKeyReused(t *testing.T) {
+	idempotency := &mockIdempotencyService{
+		BeginFunc: func(ctx context.Context, key string, body []byte) (*models.IdempotencyRecord, error) {
+			return nil, svc.ErrIdempotencyKeyReused
+		},
+	}
+	h := setupTestHandler().WithIdempotency(idempotency)
+	req := httptest.NewRequest("POST", "/api/v1/orders", strings.NewReader(`{"customer_id":"cust-2"}`))
+	req.Header.Set("Idempotency-Key", "key-1")
+	w := httptest.NewRecorder()
+	h.CreateOrder(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", w.Code)
+	}
+}
+
+// 34. Test failed request releases the key
+func TestCreateOrder_IdempotencyReleasedOnError(t *testing.T) {
+	released := false
+	idempotency := &mockIdempotencyService{
+		BeginFunc: func(ctx context.Context, key string, body []byte) (*models.IdempotencyRecord, error) {
+			return &models.IdempotencyRecord{Key: key}, nil
+		},
+		ReleaseFunc: func(ctx context.Context, reservation *models.IdempotencyRecord) error {
+			released = reservation.Key == "key-1"
+			return nil
+		},
+	}
+	service := &mockOrderService{
+		CreateOrderFunc: func(ctx context.Context, order *models.Order) error {
+			return svc.NewValidationError("customer_id", "required", "customer_id is required")
+		},
+	}
+	h := NewOrderHandler(service, 10, 100).WithIdempotency(idempotency)
+	req := httptest.NewRequest("POST", "/api/v1/orders", strings.NewReader(`{}`))
+	req.Header.Set("Idempotency-Key", "key-1")
+	w := httptest.NewRecorder()
+	h.CreateOrder(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	if !released {
+		t.Error("expected idempotency key to be released")
+	}
+}
+
+// 35. Test get order sets ETag from version
+func TestGetOrder_ETag(t *testing.T) {
+	service := &mockOrderService{
+		GetOrderFunc: func(ctx context.Context, id int64) (*models.Order, error) {
+			return &models.Order{ID: id, Version: 4}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders/42", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "42"})
+	w := httptest.NewRecorder()
+	h.GetOrder(w, req)
+	if etag := w.Header().Get("ETag"); etag != `"4"` {
+		t.Errorf("expected ETag \"4\", got %s", etag)
+	}
+}
+
+// 36. Test If-Match is passed to the service as the expected version
+func TestTransitionOrder_IfMatchVersion(t *testing.T) {
+	service := &mockOrderService{
+		TransitionFunc: func(ctx context.Context, id int64, update *models.StatusUpdate) (*models.Order, error) {
+			if update.ExpectedVersion == nil || *update.ExpectedVersion != 3 {
+				t.Errorf("expected version 3, got %v", update.ExpectedVersion)
+			}
+			return &models.Order{ID: id, Status: update.Status, Version: 4}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("POST", "/api/v1/orders/8/transitions", strings.NewReader(`{"status":"processing"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "8"})
+	req.Header.Set("If-Match", `"3"`)
+	w := httptest.NewRecorder()
+	h.TransitionOrder(w, req)
 	if w.Code != http.StatusOK {
 		t.Errorf("expected 200, got %d", w.Code)
 	}
+	if etag := w.Header().Get("ETag"); etag != `"4"` {
+		t.Errorf("expected new ETag \"4\", got %s", etag)
+	}
+}
+
+// 37. Test missing If-Match returns 428
+func TestTransitionOrder_MissingIfMatch(t *testing.T) {
+	h := setupTestHandler()
+	req := httptest.NewRequest("POST", "/api/v1/orders/8/transitions", strings.NewReader(`{"status":"processing"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "8"})
+	w := httptest.NewRecorder()
+	h.TransitionOrder(w, req)
+	if w.Code != http.StatusPreconditionRequired {
+		t.Errorf("expected 428, got %d", w.Code)
+	}
+}
+
+// 38. Test stale version returns 412
+func TestCancelOrder_VersionConflict(t *testing.T) {
+	service := &mockOrderService{
+		CancelFunc: func(ctx context.Context, id int64, req *models.CancelRequest) (*models.Order, error) {
+			return nil, svc.ErrVersionConflict.Wrap(&svc.VersionConflictError{OrderID: id, ExpectedVersion: 1, CurrentVersion: 2})
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("POST", "/api/v1/orders/8/cancel", strings.NewReader(`{"reason_code":"fraud"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "8"})
+	req.Header.Set("If-Match", `"1"`)
+	w := httptest.NewRecorder()
+	h.CancelOrder(w, req)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412, got %d", w.Code)
+	}
+}
+
+// 39. Test empty cursor starts keyset pagination
+func TestListOrders_CursorFirstPage(t *testing.T) {
+	service := &mockOrderService{
+		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
+			if !pagination.Keyset || pagination.Cursor != nil {
+				t.Errorf("expected keyset pagination from the first page, got %+v", pagination)
+			}
+			return &models.PaginatedOrders{Orders: []models.Order{}, Limit: pagination.Limit, Keyset: true, NextCursor: "next"}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders?cursor=&limit=5", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"next_cursor":"next"`) {
+		t.Errorf("expected next_cursor in response, got %s", w.Body.String())
+	}
+}
+
+// 40. Test cursor is decoded and passed to the service
+func TestListOrders_CursorNextPage(t *testing.T) {
+	cursor := models.Cursor{CreatedAt: time.Date(2026, 2, 9, 10, 30, 0, 0, time.UTC), ID: 17}
+	service := &mockOrderService{
+		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
+			if pagination.Cursor == nil || pagination.Cursor.ID != 17 || !pagination.Cursor.CreatedAt.Equal(cursor.CreatedAt) {
+				t.Errorf("expected cursor at order 17, got %+v", pagination.Cursor)
+			}
+			return &models.PaginatedOrders{Orders: []models.Order{}, Limit: pagination.Limit, Keyset: true}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders?cursor="+cursor.Encode(), nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+// 41. Test malformed cursor returns 400
+func TestListOrders_InvalidCursor(t *testing.T) {
+	h := setupTestHandler()
+	req := httptest.NewRequest("GET", "/api/v1/orders?cursor=garbage", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+// 42. Test sort parameter is parsed
+func TestListOrders_Sort(t *testing.T) {
+	service := &mockOrderService{
+		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
+			want := []models.SortField{{Field: "total_amount", Desc: true}, {Field: "created_at"}}
+			if len(pagination.Sort) != 2 || pagination.Sort[0] != want[0] || pagination.Sort[1] != want[1] {
+				t.Errorf("expected sort %+v, got %+v", want, pagination.Sort)
+			}
+			return &models.PaginatedOrders{Orders: []models.Order{}, Total: 0, Page: 1, Limit: 10, TotalPages: 1}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders?sort=-total_amount,created_at", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+// 43. Test unknown sort key returns 400
+func TestListOrders_UnknownSortKey(t *testing.T) {
+	h := setupTestHandler()
+	req := httptest.NewRequest("GET", "/api/v1/orders?sort=created_at%3BDROP+TABLE+orders", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+// 44. Test every invalid parameter is reported at once
+func TestListOrders_ReportsAllInvalidParams(t *testing.T) {
+	h := setupTestHandler()
+	req := httptest.NewRequest("GET", "/api/v1/orders?status=lost&min_amount=500&max_amount=100&from_date=2026-03-01&to_date=2026-02-01&currency=dollars", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	var body response.ProblemDetails
+	json.NewDecoder(w.Body).Decode(&body)
+	fields := map[string]bool{}
+	for _, e := range body.Errors {
+		fields[e.Field] = true
+	}
+	for _, field := range []string{"status", "min_amount", "from_date", "currency"} {
+		if !fields[field] {
+			t.Errorf("expected an error for %s, got %+v", field, body.Errors)
+		}
+	}
+}
+
+// 45. Test unknown parameters are only rejected in strict mode
+func TestListOrders_StrictUnknownParams(t *testing.T) {
+	h := setupTestHandler()
+	req := httptest.NewRequest("GET", "/api/v1/orders?stauts=pending", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 without strict, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/orders?stauts=pending&strict=true", nil)
+	w = httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 in strict mode, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"field":"stauts"`) {
+		t.Errorf("expected stauts to be reported, got %s", w.Body.String())
+	}
+}
+
+// 46. Test errors are reported as problem details
+func TestGetOrder_NotFoundProblem(t *testing.T) {
+	service := &mockOrderService{
+		GetOrderFunc: func(ctx context.Context, id int64) (*models.Order, error) {
+			return nil, svc.ErrOrderNotFound
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders/99", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "99"})
+	w := httptest.NewRecorder()
+	h.GetOrder(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != response.ProblemContentType {
+		t.Errorf("expected %s, got %s", response.ProblemContentType, ct)
+	}
+	var body response.ProblemDetails
+	json.NewDecoder(w.Body).Decode(&body)
+	if body.Code != "order_not_found" || body.Type != "/problems/order_not_found" || body.Status != http.StatusNotFound {
+		t.Errorf("unexpected problem %+v", body)
+	}
+	if body.Instance != "/api/v1/orders/99" {
+		t.Errorf("expected instance /api/v1/orders/99, got %q", body.Instance)
+	}
+}
+
+// 47. Test service validation errors keep their field codes
+func TestCreateOrder_ValidationProblemFields(t *testing.T) {
+	service := &mockOrderService{
+		CreateOrderFunc: func(ctx context.Context, order *models.Order) error {
+			return svc.NewValidationError("items[0].quantity", "not_positive", "items[0].quantity must be greater than 0")
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("POST", "/api/v1/orders", strings.NewReader(`{"customer_id":"cust-1"}`))
+	w := httptest.NewRecorder()
+	h.CreateOrder(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	var body response.ProblemDetails
+	json.NewDecoder(w.Body).Decode(&body)
+	if body.Code != svc.CodeValidationFailed || len(body.Errors) != 1 {
+		t.Fatalf("unexpected problem %+v", body)
+	}
+	if body.Errors[0].Field != "items[0].quantity" || body.Errors[0].Code != "not_positive" {
+		t.Errorf("unexpected field error %+v", body.Errors[0])
+	}
+}
+
+// 48. Test unexpected errors are internal errors
+func TestListOrders_InternalErrorProblem(t *testing.T) {
+	service := &mockOrderService{
+		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"code":"internal_error"`) {
+		t.Errorf("expected internal_error code, got %s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "connection refused") {
+		t.Errorf("expected the internal error message to be hidden, got %s", w.Body.String())
+	}
+}
+
+// 49. Test multi-value, product and updated_since filters
+func TestListOrders_MultiValueFilters(t *testing.T) {
+	service := &mockOrderService{
+		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
+			if len(filter.Statuses) != 2 || filter.Statuses[0] != "pending" || filter.Statuses[1] != "processing" {
+				t.Errorf("expected statuses [pending processing], got %v", filter.Statuses)
+			}
+			if len(filter.CustomerIDs) != 2 || filter.CustomerIDs[0] != "cust-1" || filter.CustomerIDs[1] != "cust-2" {
+				t.Errorf("expected customer IDs [cust-1 cust-2], got %v", filter.CustomerIDs)
+			}
+			if len(filter.ProductIDs) != 1 || filter.ProductIDs[0] != "prod-7" {
+				t.Errorf("expected product IDs [prod-7], got %v", filter.ProductIDs)
+			}
+			if len(filter.IDs) != 3 || filter.IDs[2] != 9 {
+				t.Errorf("expected IDs [1 4 9], got %v", filter.IDs)
+			}
+			want := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+			if filter.UpdatedSince == nil || !filter.UpdatedSince.Equal(want) {
+				t.Errorf("expected updated_since %v, got %v", want, filter.UpdatedSince)
+			}
+			return &models.PaginatedOrders{Orders: []models.Order{}, Total: 0, Page: 1, Limit: 10, TotalPages: 1}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders?status=pending,processing&customer_id=cust-1&customer_id=cust-2,cust-1&product_id=prod-7&id=1,4,9&updated_since=2026-03-01T10:00:00%2B02:00", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+// 50. Test invalid values in multi-value filters are rejected
+func TestListOrders_InvalidMultiValueFilters(t *testing.T) {
+	h := setupTestHandler()
+	req := httptest.NewRequest("GET", "/api/v1/orders?status=pending,lost&id=1,abc&updated_since=yesterday", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	var body response.ProblemDetails
+	json.NewDecoder(w.Body).Decode(&body)
+	if len(body.Errors) != 3 {
+		t.Errorf("expected errors for status, id and updated_since, got %+v", body.Errors)
+	}
+}
+
+// 51. Test include=items asks the service for line items
+func TestListOrders_IncludeItems(t *testing.T) {
+	count := 1
+	service := &mockOrderService{
+		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
+			if !pagination.IncludeItems {
+				t.Error("expected IncludeItems to be set")
+			}
+			return &models.PaginatedOrders{
+				Orders: []models.Order{{ID: 1, Items: []models.OrderItem{{ProductID: "prod-7", Quantity: 1}}, ItemCount: &count}},
+				Total:  1, Page: 1, Limit: 10, TotalPages: 1,
+			}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders?include=items", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"product_id":"prod-7"`) || !strings.Contains(w.Body.String(), `"item_count":1`) {
+		t.Errorf("expected items and item_count in response, got %s", w.Body.String())
+	}
+}
+
+// 52. Test unknown include value returns 400
+func TestListOrders_UnknownInclude(t *testing.T) {
+	h := setupTestHandler()
+	req := httptest.NewRequest("GET", "/api/v1/orders?include=customer", nil)
+	w := httptest.NewRecorder()
+	h.ListOrders(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+// 53. Test CSV export streams one row per item when flattening
+func TestExportOrdersCSV_FlattenItems(t *testing.T) {
+	created := time.Date(2026, 2, 9, 10, 30, 0, 0, time.UTC)
+	service := &mockOrderService{
+		ExportFunc: func(ctx context.Context, filter *models.OrderFilter, includeItems bool, fn func(*models.Order) error) error {
+			if !includeItems {
+				t.Error("expected items to be requested")
+			}
+			if len(filter.Statuses) != 1 || filter.Statuses[0] != "delivered" {
+				t.Errorf("expected status filter delivered, got %v", filter.Statuses)
+			}
+			orders := []models.Order{
+				{ID: 1, CustomerID: "=cmd()", Status: "delivered", Currency: "USD", TotalAmount: 3000, Version: 2, CreatedAt: created, UpdatedAt: created,
+					Items: []models.OrderItem{{ID: 10, ProductID: "prod-1", Quantity: 1, Price: 1000}, {ID: 11, ProductID: "prod-2", Quantity: 2, Price: 1000}}},
+				{ID: 2, CustomerID: "cust-2", Status: "delivered", Currency: "USD", Version: 1, CreatedAt: created, UpdatedAt: created},
+			}
+			for i := range orders {
+				if err := fn(&orders[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders/export.csv?status=delivered&flatten_items=true", nil)
+	w := httptest.NewRecorder()
+	h.ExportOrdersCSV(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("expected text/csv, got %s", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected header and 3 rows, got %d lines:\n%s", len(lines), w.Body.String())
+	}
+	if !strings.HasPrefix(lines[0], "id,customer_id,") || !strings.HasSuffix(lines[0], ",item_id,product_id,quantity,price") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "1,'=cmd(),delivered,USD,30.00,") || !strings.HasSuffix(lines[2], ",11,prod-2,2,10.00") {
+		t.Errorf("unexpected item rows %q and %q", lines[1], lines[2])
+	}
+	if !strings.HasSuffix(lines[3], ",,,,") {
+		t.Errorf("expected an order without items to have empty item columns, got %q", lines[3])
+	}
+}
+
+// 54. Test export errors before the first row are reported as problems
+func TestExportOrdersCSV_ErrorBeforeFirstRow(t *testing.T) {
+	service := &mockOrderService{
+		ExportFunc: func(ctx context.Context, filter *models.OrderFilter, includeItems bool, fn func(*models.Order) error) error {
+			return svc.ErrCurrencyRequired
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders/export.csv?min_amount=10", nil)
+	w := httptest.NewRecorder()
+	h.ExportOrdersCSV(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != response.ProblemContentType {
+		t.Errorf("expected a problem response, got %s", ct)
+	}
+}
+
+// 55. Test an empty export still has a header row
+func TestExportOrdersCSV_Empty(t *testing.T) {
+	service := &mockOrderService{
+		ExportFunc: func(ctx context.Context, filter *models.OrderFilter, includeItems bool, fn func(*models.Order) error) error {
+			return nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders/export.csv", nil)
+	w := httptest.NewRecorder()
+	h.ExportOrdersCSV(w, req)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "id,customer_id,") {
+		t.Errorf("expected 200 with a header row, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// 56. Test a fully created batch returns 201 with the new IDs
+func TestCreateOrders_AllCreated(t *testing.T) {
+	service := &mockOrderService{
+		CreateBatchFunc: func(ctx context.Context, orders []models.Order, mode models.BatchMode) ([]svc.BatchOrderResult, error) {
+			results := make([]svc.BatchOrderResult, len(orders))
+			for i := range orders {
+				orders[i].ID = int64(100 + i)
+				results[i] = svc.BatchOrderResult{Index: i, Order: &orders[i]}
+			}
+			return results, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	body := `{"orders":[{"customer_id":"cust-1"},{"customer_id":"cust-2"}]}`
+	req := httptest.NewRequest("POST", "/api/v1/orders/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.CreateOrders(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp batchCreateResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Mode != models.BatchAtomic || resp.Created != 2 || resp.Failed != 0 {
+		t.Errorf("expected 2 orders created atomically, got %+v", resp)
+	}
+	if resp.Results[1].Index != 1 || resp.Results[1].ID != 101 || resp.Results[1].Status != "created" {
+		t.Errorf("unexpected second result %+v", resp.Results[1])
+	}
+}
+
+// 57. Test a partial batch reports each failed order as a problem with 207
+func TestCreateOrders_PartialFailure(t *testing.T) {
+	service := &mockOrderService{
+		CreateBatchFunc: func(ctx context.Context, orders []models.Order, mode models.BatchMode) ([]svc.BatchOrderResult, error) {
+			if mode != models.BatchPartial {
+				t.Errorf("expected partial mode, got %q", mode)
+			}
+			return []svc.BatchOrderResult{
+				{Index: 0, Order: &models.Order{ID: 7}},
+				{Index: 1, Err: svc.NewValidationError("customer_id", "required", "customer_id is required")},
+			}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	body := `{"mode":"partial","orders":[{"customer_id":"cust-1"},{}]}`
+	req := httptest.NewRequest("POST", "/api/v1/orders/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.CreateOrders(w, req)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got %d", w.Code)
+	}
+	var resp struct {
+		Created int `json:"created"`
+		Failed  int `json:"failed"`
+		Results []struct {
+			Status string                   `json:"status"`
+			Error  *response.ProblemDetails `json:"error"`
+		} `json:"results"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Created != 1 || resp.Failed != 1 {
+		t.Fatalf("expected 1 created and 1 failed, got %+v", resp)
+	}
+	failed := resp.Results[1]
+	if failed.Status != "failed" || failed.Error == nil || failed.Error.Code != "validation_failed" || failed.Error.Status != http.StatusBadRequest {
+		t.Errorf("unexpected failed result %+v", failed)
+	}
+	if len(failed.Error.Errors) != 1 || failed.Error.Errors[0].Field != "customer_id" {
+		t.Errorf("expected the customer_id field error, got %+v", failed.Error.Errors)
+	}
+}
+
+// 58. Test a batch over the configured limit is rejected before the service
+func TestCreateOrders_TooLarge(t *testing.T) {
+	h := NewOrderHandler(&mockOrderService{}, 10, 100).WithMaxBatchSize(2)
+	body := `{"orders":[{},{},{}]}`
+	req := httptest.NewRequest("POST", "/api/v1/orders/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.CreateOrders(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", w.Code)
+	}
+}
+
+// 59. Test a bulk status change reports each order's outcome
+func TestBulkUpdateStatus_Outcomes(t *testing.T) {
+	service := &mockOrderService{
+		BulkStatusFunc: func(ctx context.Context, ids []int64, filter *models.OrderFilter, update *models.StatusUpdate, limit int) ([]svc.BulkStatusResult, error) {
+			if update.Status != "shipped" || len(ids) != 3 || limit != 50 {
+				t.Errorf("unexpected arguments %v %+v %d", ids, update, limit)
+			}
+			transitionErr := &svc.TransitionError{From: models.StatusPending, To: models.StatusShipped, Allowed: svc.AllowedTransitions(models.StatusPending)}
+			return []svc.BulkStatusResult{
+				{OrderID: 1, Outcome: svc.BulkOutcomeUpdated, Order: &models.Order{ID: 1, Version: 3}},
+				{OrderID: 2, Outcome: svc.BulkOutcomeUnchanged},
+				{OrderID: 3, Outcome: svc.BulkOutcomeFailed, Err: svc.ErrInvalidTransition.Wrap(transitionErr)},
+			}, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100).WithMaxBatchSize(50)
+	req := httptest.NewRequest("POST", "/api/v1/orders/bulk-status", strings.NewReader(`{"ids":[1,2,3],"status":"shipped","actor":"warehouse"}`))
+	w := httptest.NewRecorder()
+	h.BulkUpdateStatus(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Matched, Updated, Unchanged, Failed int
+		Results                             []map[string]interface{}
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Matched != 3 || resp.Updated != 1 || resp.Unchanged != 1 || resp.Failed != 1 {
+		t.Fatalf("unexpected summary %+v", resp)
+	}
+	if resp.Results[0]["version"] != float64(3) {
+		t.Errorf("expected the updated order's version, got %v", resp.Results[0])
+	}
+	failure, _ := resp.Results[2]["error"].(map[string]interface{})
+	if failure["code"] != "invalid_transition" || failure["current_status"] != "pending" {
+		t.Errorf("expected an invalid_transition problem with the current status, got %v", failure)
+	}
+}
+
+// 60. Test a bulk status change passes query parameters as the filter
+func TestBulkUpdateStatus_Filter(t *testing.T) {
+	service := &mockOrderService{
+		BulkStatusFunc: func(ctx context.Context, ids []int64, filter *models.OrderFilter, update *models.StatusUpdate, limit int) ([]svc.BulkStatusResult, error) {
+			if len(ids) != 0 || len(filter.Statuses) != 1 || filter.Statuses[0] != "processing" {
+				t.Errorf("expected the status filter and no ids, got %v %+v", ids, filter)
+			}
+			return nil, nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100)
+	req := httptest.NewRequest("POST", "/api/v1/orders/bulk-status?status=processing", strings.NewReader(`{"status":"shipped"}`))
+	w := httptest.NewRecorder()
+	h.BulkUpdateStatus(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+// 61. Test a bulk status change without a target status is rejected
+func TestBulkUpdateStatus_MissingStatus(t *testing.T) {
+	h := NewOrderHandler(&mockOrderService{}, 10, 100)
+	req := httptest.NewRequest("POST", "/api/v1/orders/bulk-status", strings.NewReader(`{"ids":[1]}`))
+	w := httptest.NewRecorder()
+	h.BulkUpdateStatus(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+// 62. Test the order stream resumes after Last-Event-ID and writes SSE events
+func TestStreamOrders_Events(t *testing.T) {
+	stream := &mockOrderStream{
+		StreamFunc: func(ctx context.Context, filter *models.OrderFilter, position *models.StreamPosition, fn func(*models.OrderChange) error) error {
+			if position == nil || position.Seq != 41 || len(position.Pending) != 1 || position.Pending[0] != 39 {
+				t.Errorf("expected to resume after 41 with 39 pending, got %+v", position)
+			}
+			if len(filter.CustomerIDs) != 1 || filter.CustomerIDs[0] != "cust-1" {
+				t.Errorf("expected customer filter cust-1, got %v", filter.CustomerIDs)
+			}
+			changes := []*models.OrderChange{
+				{Seq: 42, Type: models.EventOrderCreated, Data: models.OrderEventData{Order: &models.Order{ID: 7, CustomerID: "cust-1", Status: "pending"}},
+					Position: models.StreamPosition{Seq: 42, Pending: []int64{39}}},
+				{Seq: 43, Type: models.EventOrderStatusChanged, Data: models.OrderEventData{Order: &models.Order{ID: 7, CustomerID: "cust-1", Status: "processing"}, PreviousStatus: "pending"},
+					Position: models.StreamPosition{Seq: 43}},
+			}
+			for _, change := range changes {
+				if err := fn(change); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	h := NewOrderHandler(&mockOrderService{}, 10, 100).WithStream(stream)
+	req := httptest.NewRequest("GET", "/api/v1/orders/stream?customer_id=cust-1", nil)
+	req.Header.Set("Last-Event-ID", "41:39")
+	w := httptest.NewRecorder()
+	h.StreamOrders(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %s", ct)
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "retry: 3000\n\n") {
+		t.Errorf("expected a retry hint first, got %q", body)
+	}
+	if !strings.Contains(body, "id: 42:39\nevent: order.created\ndata: {\"order\":{\"id\":7,") {
+		t.Errorf("expected an order.created event with id 42:39, got %q", body)
+	}
+	if !strings.Contains(body, "id: 43\nevent: order.updated\ndata: {") || !strings.Contains(body, `"previous_status":"pending"}`+"\n\n") {
+		t.Errorf("expected an order.updated event with id 43, got %q", body)
+	}
+}
+
+// 63. Test an invalid Last-Event-ID is rejected before streaming
+func TestStreamOrders_InvalidLastEventID(t *testing.T) {
+	stream := &mockOrderStream{
+		StreamFunc: func(ctx context.Context, filter *models.OrderFilter, position *models.StreamPosition, fn func(*models.OrderChange) error) error {
+			t.Error("expected the stream not to be opened")
+			return nil
+		},
+	}
+	h := NewOrderHandler(&mockOrderService{}, 10, 100).WithStream(stream)
+	req := httptest.NewRequest("GET", "/api/v1/orders/stream?last_event_id=abc", nil)
+	w := httptest.NewRecorder()
+	h.StreamOrders(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+// 64. Test the stream is unavailable when not enabled
+func TestStreamOrders_NotEnabled(t *testing.T) {
+	h := NewOrderHandler(&mockOrderService{}, 10, 100)
+	req := httptest.NewRequest("GET", "/api/v1/orders/stream", nil)
+	w := httptest.NewRecorder()
+	h.StreamOrders(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", w.Code)
+	}
+}
+
+// 65. Test a created order whose idempotent response cannot be stored is reported with its ID
+func TestCreateOrder_IdempotencyNotRecorded(t *testing.T) {
+	idempotency := &mockIdempotencyService{
+		BeginFunc: func(ctx context.Context, key string, body []byte) (*models.IdempotencyRecord, error) {
+			return &models.IdempotencyRecord{Key: key}, nil
+		},
+		CompleteFunc: func(ctx context.Context, reservation *models.IdempotencyRecord, status int, body []byte) error {
+			return errors.New("connection reset")
+		},
+	}
+	service := &mockOrderService{
+		CreateOrderFunc: func(ctx context.Context, order *models.Order) error {
+			order.ID = 12
+			return nil
+		},
+	}
+	h := NewOrderHandler(service, 10, 100).WithIdempotency(idempotency)
+	req := httptest.NewRequest("POST", "/api/v1/orders", strings.NewReader(`{"customer_id":"cust-1"}`))
+	req.Header.Set("Idempotency-Key", "key-1")
+	w := httptest.NewRecorder()
+	h.CreateOrder(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	var problem map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("failed to decode problem: %v", err)
+	}
+	if problem["code"] != "idempotency_not_recorded" || problem["order_id"] != float64(12) {
+		t.Errorf("expected idempotency_not_recorded for order 12, got %v", problem)
+	}
+}
+
+// 66. Test an oversized batch body is rejected without being read whole
+func TestCreateOrders_BodyTooLarge(t *testing.T) {
+	h := NewOrderHandler(&mockOrderService{}, 10, 100).WithMaxBatchSize(1)
+	body := `{"orders":[{"customer_id":"` + strings.Repeat("x", 2*maxBatchOrderBytes) + `"}]}`
+	req := httptest.NewRequest("POST", "/api/v1/orders/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.CreateOrders(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "batch_too_large") {
+		t.Errorf("expected 413 batch_too_large, got %d %s", w.Code, w.Body.String())
+	}
 }
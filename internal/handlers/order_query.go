@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/pkg/response"
+)
+
+// dateLayout is the format of date query parameters
+const dateLayout = "2006-01-02"
+
+var currencyPattern = regexp.MustCompile(`^[A-Za-z]{3}$`)
+
+// paginationParams are understood by every paginated list endpoint
+var paginationParams = []string{"page", "limit", "sort", "cursor", includeParam}
+
+// orderFilterParams map onto models.OrderFilter
+var orderFilterParams = []string{
+	"id", "customer_id", "status", "product_id", "cancellation_reason", "currency",
+	"min_amount", "max_amount", "from_date", "to_date", "updated_since",
+}
+
+// includeParam names related data to embed in list results
+const includeParam = "include"
+
+// maxFilterValues bounds how many values a multi-value filter accepts
+const maxFilterValues = 100
+
+// strictParam makes unknown query parameters an error instead of ignoring them
+const strictParam = "strict"
+
+// queryErrors collects every problem found in a query string so they can be
+// reported together
+type queryErrors []response.FieldError
+
+func (e *queryErrors) add(field, code, format string, args ...interface{}) {
+	*e = append(*e, response.FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// parsePagination reads page, limit, sort, cursor and include. limit is
+// capped at the handler's maximum page size.
+func (h *OrderHandler) parsePagination(q url.Values, errs *queryErrors) *models.Pagination {
+	pagination := &models.Pagination{Page: 1, Limit: h.defaultPageSize}
+
+	if pageStr := q.Get("page"); pageStr != "" {
+		page, err := strconv.Atoi(pageStr)
+		switch {
+		case err != nil:
+			errs.add("page", "not_an_integer", "must be an integer")
+		case page < 1:
+			errs.add("page", "out_of_range", "must be at least 1")
+		default:
+			pagination.Page = page
+		}
+	}
+
+	if limitStr := q.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		switch {
+		case err != nil:
+			errs.add("limit", "not_an_integer", "must be an integer")
+		case limit < 1:
+			errs.add("limit", "out_of_range", "must be at least 1")
+		case limit > h.maxPageSize:
+			pagination.Limit = h.maxPageSize
+		default:
+			pagination.Limit = limit
+		}
+	}
+
+	if sortStr := q.Get("sort"); sortStr != "" {
+		sortFields, err := models.ParseSort(sortStr)
+		if err != nil {
+			errs.add("sort", "invalid_sort", "%s", err.Error())
+		}
+		pagination.Sort = sortFields
+	}
+
+	// The presence of cursor (even empty, for the first page) switches to
+	// keyset pagination, which is always ordered newest first
+	if q.Has("cursor") {
+		pagination.Keyset = true
+		if q.Get("sort") != "" {
+			errs.add("cursor", "conflicting_parameter", "cannot be combined with sort")
+		}
+		if q.Get("page") != "" {
+			errs.add("cursor", "conflicting_parameter", "cannot be combined with page")
+		}
+		if rawCursor := q.Get("cursor"); rawCursor != "" {
+			cursor, err := models.DecodeCursor(rawCursor)
+			if err != nil {
+				errs.add("cursor", "invalid_cursor", "is not a cursor returned by this API")
+			}
+			pagination.Cursor = cursor
+		}
+	}
+
+	for _, include := range listParam(q, includeParam, errs) {
+		if include != "items" {
+			errs.add(includeParam, "unknown_value", "unknown include %q; allowed: items", include)
+			continue
+		}
+		pagination.IncludeItems = true
+	}
+
+	return pagination
+}
+
+// parseOrderFilter reads the order filter parameters, validating each value
+// and the relationships between them
+func parseOrderFilter(q url.Values, errs *queryErrors) *models.OrderFilter {
+	filter := &models.OrderFilter{}
+
+	for _, rawID := range listParam(q, "id", errs) {
+		id, err := strconv.ParseInt(rawID, 10, 64)
+		if err != nil || id < 1 {
+			errs.add("id", "invalid_format", "%q is not a valid order ID", rawID)
+			continue
+		}
+		filter.IDs = append(filter.IDs, id)
+	}
+
+	filter.CustomerIDs = listParam(q, "customer_id", errs)
+	filter.ProductIDs = listParam(q, "product_id", errs)
+
+	for _, status := range listParam(q, "status", errs) {
+		if !models.OrderStatus(status).IsValid() {
+			errs.add("status", "unknown_value", "unknown status %q; allowed: pending, processing, shipped, delivered, cancelled", status)
+			continue
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+
+	if reason := q.Get("cancellation_reason"); reason != "" {
+		if models.CancellationReason(reason).IsValid() {
+			filter.CancellationReason = &reason
+		} else {
+			errs.add("cancellation_reason", "unknown_value", "unknown reason %q; allowed: customer_request, fraud, out_of_stock, other", reason)
+		}
+	}
+
+	if currency := q.Get("currency"); currency != "" {
+		if currencyPattern.MatchString(currency) {
+			currency = strings.ToUpper(currency)
+			filter.Currency = &currency
+		} else {
+			errs.add("currency", "invalid_format", "must be a three-letter ISO-4217 code")
+		}
+	}
+
+	filter.MinAmount = parseAmountParam(q, "min_amount", errs)
+	filter.MaxAmount = parseAmountParam(q, "max_amount", errs)
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		errs.add("min_amount", "invalid_range", "must not be greater than max_amount")
+	}
+
+	filter.FromDate = parseDateParam(q, "from_date", errs)
+	filter.ToDate = parseDateParam(q, "to_date", errs)
+	if filter.FromDate != nil && filter.ToDate != nil && filter.FromDate.After(*filter.ToDate) {
+		errs.add("from_date", "invalid_range", "must not be after to_date")
+	}
+
+	if value := q.Get("updated_since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			since, err = time.Parse(dateLayout, value)
+		}
+		if err != nil {
+			errs.add("updated_since", "invalid_format", "must be an RFC 3339 timestamp or a date in YYYY-MM-DD format")
+		} else {
+			// Timestamps are stored in UTC without a zone
+			since = since.UTC()
+			filter.UpdatedSince = &since
+		}
+	}
+
+	return filter
+}
+
+// listParam reads a filter that accepts several values, given either as a
+// comma-separated list (status=pending,processing) or by repeating the
+// parameter. Empty entries and duplicates are dropped.
+func listParam(q url.Values, name string, errs *queryErrors) []string {
+	var values []string
+	seen := map[string]bool{}
+	for _, raw := range q[name] {
+		for _, value := range strings.Split(raw, ",") {
+			value = strings.TrimSpace(value)
+			if value == "" || seen[value] {
+				continue
+			}
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	if len(values) > maxFilterValues {
+		errs.add(name, "too_many_values", "accepts at most %d values", maxFilterValues)
+		return nil
+	}
+	return values
+}
+
+func parseAmountParam(q url.Values, name string, errs *queryErrors) *models.Money {
+	value := q.Get(name)
+	if value == "" {
+		return nil
+	}
+	amount, err := models.ParseMoney(value)
+	if err != nil {
+		errs.add(name, "invalid_format", "must be a decimal amount with at most two decimal places")
+		return nil
+	}
+	if amount < 0 {
+		errs.add(name, "negative", "must be non-negative")
+		return nil
+	}
+	return &amount
+}
+
+func parseDateParam(q url.Values, name string, errs *queryErrors) *time.Time {
+	value := q.Get(name)
+	if value == "" {
+		return nil
+	}
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		errs.add(name, "invalid_format", "must be a date in YYYY-MM-DD format")
+		return nil
+	}
+	return &date
+}
+
+// parseBoolParam reads an optional true/false parameter, defaulting to false
+func parseBoolParam(q url.Values, name string, errs *queryErrors) bool {
+	value := q.Get(name)
+	if value == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		errs.add(name, "not_a_boolean", "must be true or false")
+		return false
+	}
+	return b
+}
+
+// checkUnknownParams reports parameters outside known when the request asks
+// for strict validation with strict=true
+func checkUnknownParams(q url.Values, errs *queryErrors, known ...[]string) {
+	if !parseBoolParam(q, strictParam, errs) {
+		return
+	}
+
+	allowed := map[string]bool{strictParam: true}
+	for _, names := range known {
+		for _, name := range names {
+			allowed[name] = true
+		}
+	}
+
+	var unknown []string
+	for name := range q {
+		if !allowed[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs.add(name, "unknown_parameter", "unknown query parameter")
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/service"
+)
+
+// streamParams are understood by the order stream in addition to the order
+// filters
+var streamParams = []string{"last_event_id"}
+
+// lastEventIDHeader is sent by EventSource clients when they reconnect
+const lastEventIDHeader = "Last-Event-ID"
+
+// streamHeartbeatInterval is how often an idle stream gets a comment line, so
+// that proxies keep it open and closed connections are noticed
+const streamHeartbeatInterval = 15 * time.Second
+
+// streamRetryMillis is the reconnection delay suggested to clients
+const streamRetryMillis = 3000
+
+// streamEventNames are the SSE event names of the order event types
+var streamEventNames = map[string]string{
+	models.EventOrderCreated:       "order.created",
+	models.EventOrderStatusChanged: "order.updated",
+}
+
+// WithStream enables StreamOrders
+func (h *OrderHandler) WithStream(stream service.OrderStreamInterface) *OrderHandler {
+	h.stream = stream
+	return h
+}
+
+// StreamOrders pushes changes to orders matching the filters as Server-Sent
+// Events. Each event's id is the stream's position, which can be sent back
+// as Last-Event-ID, or as the last_event_id parameter, to resume after the
+// changes already received.
+func (h *OrderHandler) StreamOrders(w http.ResponseWriter, r *http.Request) {
+	if h.stream == nil {
+		writeProblem(w, r, http.StatusServiceUnavailable, codeStreamUnavailable, "Order streaming is not enabled")
+		return
+	}
+	query := r.URL.Query()
+
+	var errs queryErrors
+	filter := parseOrderFilter(query, &errs)
+	lastEventID := r.Header.Get(lastEventIDHeader)
+	if lastEventID == "" {
+		lastEventID = query.Get("last_event_id")
+	}
+	var position *models.StreamPosition
+	if lastEventID != "" {
+		parsed, err := models.ParseStreamPosition(lastEventID)
+		if err != nil {
+			errs.add("last_event_id", "invalid_format", "must be the id of an event from this stream")
+		} else {
+			position = &parsed
+		}
+	}
+	checkUnknownParams(query, &errs, streamParams, orderFilterParams)
+	if len(errs) > 0 {
+		writeValidationProblem(w, r, "Invalid query parameters", errs)
+		return
+	}
+
+	// A stream stays open far longer than the server's write timeout
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Failed to clear write deadline for order stream: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keeps nginx and similar proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Events and heartbeats are written from different goroutines
+	var mu sync.Mutex
+	write := func(chunk string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := io.WriteString(w, chunk); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+	if err := write(fmt.Sprintf("retry: %d\n\n", streamRetryMillis)); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	var heartbeats sync.WaitGroup
+	defer heartbeats.Wait()
+	defer cancel()
+
+	heartbeats.Add(1)
+	go func() {
+		defer heartbeats.Done()
+		ticker := time.NewTicker(streamHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := write(": keep-alive\n\n"); err != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := h.stream.StreamOrderChanges(ctx, filter, position, func(change *models.OrderChange) error {
+		name, ok := streamEventNames[change.Type]
+		if !ok {
+			return nil
+		}
+		data, err := json.Marshal(change.Data)
+		if err != nil {
+			return err
+		}
+		return write(fmt.Sprintf("id: %s\nevent: %s\ndata: %s\n\n", change.Position, name, data))
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Order stream ended: %v", err)
+	}
+}
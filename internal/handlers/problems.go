@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/sabina/orders-api/internal/service"
+	"github.com/sabina/orders-api/pkg/response"
+)
+
+// Problem codes for failures detected by the handlers themselves
+const (
+	codeInvalidBody            = "invalid_body"
+	codeInvalidOrderID         = "invalid_order_id"
+	codeIfMatchRequired        = "if_match_required"
+	codeIdempotencyKeyTooLong  = "idempotency_key_too_long"
+	codeBatchTooLarge          = "batch_too_large"
+	codeStreamUnavailable      = "stream_unavailable"
+	codeIdempotencyNotRecorded = "idempotency_not_recorded"
+	codeInternalError          = "internal_error"
+	codeValidationFailed       = service.CodeValidationFailed
+)
+
+// kindStatus maps domain error kinds to HTTP statuses
+var kindStatus = map[service.ErrorKind]int{
+	service.KindValidation:         http.StatusBadRequest,
+	service.KindUnprocessable:      http.StatusUnprocessableEntity,
+	service.KindNotFound:           http.StatusNotFound,
+	service.KindConflict:           http.StatusConflict,
+	service.KindPreconditionFailed: http.StatusPreconditionFailed,
+	service.KindTooLarge:           http.StatusRequestEntityTooLarge,
+}
+
+// writeError reports err as a problem. Domain errors keep their code and
+// field errors; any other error is reported as an internal error.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	response.Problem(w, r, problemFor(err))
+}
+
+// problemFor describes err as a problem without writing it. Errors other than
+// domain errors are logged and described generically, since their messages
+// come from the database or other internals.
+func problemFor(err error) response.ProblemDetails {
+	var domainErr *service.Error
+	if !errors.As(err, &domainErr) {
+		log.Printf("Internal error: %v", err)
+		return response.ProblemDetails{Status: http.StatusInternalServerError, Code: codeInternalError, Detail: "An unexpected error occurred"}
+	}
+	status, ok := kindStatus[domainErr.Kind]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	problem := response.ProblemDetails{
+		Status: status,
+		Code:   domainErr.Code,
+		Detail: err.Error(),
+	}
+	for _, field := range domainErr.Fields {
+		problem.Errors = append(problem.Errors, response.FieldError{
+			Field:   field.Field,
+			Code:    field.Code,
+			Message: field.Message,
+		})
+	}
+
+	// A rejected transition also tells the client where the order can go
+	var transitionErr *service.TransitionError
+	if errors.As(err, &transitionErr) {
+		problem.Extensions = map[string]interface{}{
+			"current_status":      transitionErr.From,
+			"allowed_transitions": transitionErr.Allowed,
+		}
+	}
+	return problem
+}
+
+// writeProblem reports a failure detected by the handler itself
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	response.Problem(w, r, response.ProblemDetails{Status: status, Code: code, Detail: detail})
+}
+
+// writeValidationProblem reports invalid request fields or query parameters
+func writeValidationProblem(w http.ResponseWriter, r *http.Request, detail string, errs []response.FieldError) {
+	response.Problem(w, r, response.ProblemDetails{
+		Status: http.StatusBadRequest,
+		Code:   codeValidationFailed,
+		Detail: detail,
+		Errors: errs,
+	})
+}
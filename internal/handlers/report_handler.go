@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/service"
+	"github.com/sabina/orders-api/pkg/response"
+)
+
+// salesReportParams are understood by the sales report in addition to the
+// order filters
+var salesReportParams = []string{"interval", "from", "to", "group_by", "include_cancelled"}
+
+// productReportParams are understood by the product report in addition to
+// the order filters
+var productReportParams = []string{"from", "to", "sort", "limit", "include_cancelled"}
+
+type ReportHandler struct {
+	service service.ReportServiceInterface
+}
+
+func NewReportHandler(service service.ReportServiceInterface) *ReportHandler {
+	return &ReportHandler{service: service}
+}
+
+func (h *ReportHandler) SalesReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var errs queryErrors
+	report := &models.SalesReportQuery{
+		Interval:         models.ReportInterval(query.Get("interval")),
+		GroupBy:          query.Get("group_by"),
+		Filter:           parseOrderFilter(query, &errs),
+		IncludeCancelled: parseBoolParam(query, "include_cancelled", &errs),
+	}
+	if from := parseDateParam(query, "from", &errs); from != nil {
+		report.From = *from
+	}
+	if to := parseDateParam(query, "to", &errs); to != nil {
+		report.To = *to
+	}
+	checkUnknownParams(query, &errs, salesReportParams, orderFilterParams)
+	if len(errs) > 0 {
+		writeValidationProblem(w, r, "Invalid query parameters", errs)
+		return
+	}
+
+	result, err := h.service.SalesReport(r.Context(), report)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, result)
+}
+
+func (h *ReportHandler) CustomerSummary(w http.ResponseWriter, r *http.Request) {
+	summary, err := h.service.CustomerSummary(r.Context(), mux.Vars(r)["customer_id"])
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, summary)
+}
+
+func (h *ReportHandler) ProductReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var errs queryErrors
+	report := &models.ProductReportQuery{
+		Filter:           parseOrderFilter(query, &errs),
+		IncludeCancelled: parseBoolParam(query, "include_cancelled", &errs),
+	}
+	if from := parseDateParam(query, "from", &errs); from != nil {
+		report.From = *from
+	}
+	if to := parseDateParam(query, "to", &errs); to != nil {
+		report.To = *to
+	}
+	if sortStr := query.Get("sort"); sortStr != "" {
+		sortFields, err := models.ParseSortFields(sortStr, models.SortableProductFields)
+		if err != nil {
+			errs.add("sort", "invalid_sort", "%s", err.Error())
+		}
+		report.Sort = sortFields
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		switch {
+		case err != nil:
+			errs.add("limit", "not_an_integer", "must be an integer")
+		case limit < 1:
+			errs.add("limit", "out_of_range", "must be at least 1")
+		default:
+			report.Limit = limit
+		}
+	}
+	checkUnknownParams(query, &errs, productReportParams, orderFilterParams)
+	if len(errs) > 0 {
+		writeValidationProblem(w, r, "Invalid query parameters", errs)
+		return
+	}
+
+	result, err := h.service.ProductReport(r.Context(), report)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, result)
+}
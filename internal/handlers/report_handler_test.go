@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sabina/orders-api/internal/models"
+	svc "github.com/sabina/orders-api/internal/service"
+	"github.com/sabina/orders-api/pkg/response"
+)
+
+type mockReportService struct {
+	SalesReportFunc     func(ctx context.Context, query *models.SalesReportQuery) (*models.SalesReport, error)
+	CustomerSummaryFunc func(ctx context.Context, customerID string) (*models.CustomerSummary, error)
+	ProductReportFunc   func(ctx context.Context, query *models.ProductReportQuery) (*models.ProductReport, error)
+}
+
+func (m *mockReportService) SalesReport(ctx context.Context, query *models.SalesReportQuery) (*models.SalesReport, error) {
+	return m.SalesReportFunc(ctx, query)
+}
+func (m *mockReportService) CustomerSummary(ctx context.Context, customerID string) (*models.CustomerSummary, error) {
+	return m.CustomerSummaryFunc(ctx, customerID)
+}
+func (m *mockReportService) ProductReport(ctx context.Context, query *models.ProductReportQuery) (*models.ProductReport, error) {
+	return m.ProductReportFunc(ctx, query)
+}
+
+// 1. Test sales report parses the range, grouping and order filters
+func TestSalesReport_Success(t *testing.T) {
+	service := &mockReportService{
+		SalesReportFunc: func(ctx context.Context, query *models.SalesReportQuery) (*models.SalesReport, error) {
+			if query.Interval != models.IntervalWeek || query.GroupBy != "status" {
+				t.Errorf("expected weekly report grouped by status, got %q by %q", query.Interval, query.GroupBy)
+			}
+			if !query.From.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) || !query.To.Equal(time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("unexpected range %v - %v", query.From, query.To)
+			}
+			if query.Filter.Currency == nil || *query.Filter.Currency != "EUR" {
+				t.Error("expected currency filter EUR")
+			}
+			if !query.IncludeCancelled {
+				t.Error("expected IncludeCancelled to be set")
+			}
+			return &models.SalesReport{
+				Interval: query.Interval,
+				Buckets: []models.SalesBucket{
+					{Start: query.From, SalesMetrics: models.SalesMetrics{OrderCount: 2, GrossRevenue: 3000, AverageOrderValue: 1500, ItemUnits: 3}},
+				},
+			}, nil
+		},
+	}
+	h := NewReportHandler(service)
+	req := httptest.NewRequest("GET", "/api/v1/reports/sales?interval=week&from=2026-01-01&to=2026-03-31&group_by=status&currency=eur&include_cancelled=true", nil)
+	w := httptest.NewRecorder()
+	h.SalesReport(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var report models.SalesReport
+	json.NewDecoder(w.Body).Decode(&report)
+	if len(report.Buckets) != 1 || report.Buckets[0].GrossRevenue != 3000 || report.Buckets[0].OrderCount != 2 {
+		t.Errorf("unexpected buckets %+v", report.Buckets)
+	}
+}
+
+// 2. Test malformed report parameters are reported together
+func TestSalesReport_InvalidParams(t *testing.T) {
+	service := &mockReportService{
+		SalesReportFunc: func(ctx context.Context, query *models.SalesReportQuery) (*models.SalesReport, error) {
+			t.Error("service should not be called with invalid parameters")
+			return nil, nil
+		},
+	}
+	h := NewReportHandler(service)
+	req := httptest.NewRequest("GET", "/api/v1/reports/sales?from=jan&to=2026-13-01&include_cancelled=maybe", nil)
+	w := httptest.NewRecorder()
+	h.SalesReport(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	var body response.ProblemDetails
+	json.NewDecoder(w.Body).Decode(&body)
+	if len(body.Errors) != 3 {
+		t.Errorf("expected errors for from, to and include_cancelled, got %+v", body.Errors)
+	}
+}
+
+// 3. Test service validation errors are returned as problems
+func TestSalesReport_CurrencyRequired(t *testing.T) {
+	service := &mockReportService{
+		SalesReportFunc: func(ctx context.Context, query *models.SalesReportQuery) (*models.SalesReport, error) {
+			return nil, svc.ErrReportCurrencyRequired
+		},
+	}
+	h := NewReportHandler(service)
+	req := httptest.NewRequest("GET", "/api/v1/reports/sales?from=2026-01-01&to=2026-01-31", nil)
+	w := httptest.NewRecorder()
+	h.SalesReport(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	var body response.ProblemDetails
+	json.NewDecoder(w.Body).Decode(&body)
+	if body.Code != "currency_required" {
+		t.Errorf("expected currency_required, got %q", body.Code)
+	}
+}
+
+// 4. Test customer summary passes the customer ID from the path
+func TestCustomerSummary_Success(t *testing.T) {
+	service := &mockReportService{
+		CustomerSummaryFunc: func(ctx context.Context, customerID string) (*models.CustomerSummary, error) {
+			if customerID != "cust-42" {
+				t.Errorf("expected customer cust-42, got %q", customerID)
+			}
+			return &models.CustomerSummary{
+				CustomerID:       customerID,
+				TotalOrders:      4,
+				StatusCounts:     map[models.OrderStatus]int64{models.StatusDelivered: 3, models.StatusCancelled: 1},
+				CancellationRate: 0.25,
+				Spend:            []models.CustomerSpend{{Currency: "USD", OrderCount: 3, LifetimeSpend: 30000, AverageOrderValue: 10000}},
+			}, nil
+		},
+	}
+	h := NewReportHandler(service)
+	req := httptest.NewRequest("GET", "/api/v1/customers/cust-42/summary", nil)
+	req = mux.SetURLVars(req, map[string]string{"customer_id": "cust-42"})
+	w := httptest.NewRecorder()
+	h.CustomerSummary(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var summary models.CustomerSummary
+	json.NewDecoder(w.Body).Decode(&summary)
+	if summary.TotalOrders != 4 || summary.CancellationRate != 0.25 || summary.StatusCounts[models.StatusDelivered] != 3 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+// 5. Test customer without orders returns 404
+func TestCustomerSummary_NotFound(t *testing.T) {
+	service := &mockReportService{
+		CustomerSummaryFunc: func(ctx context.Context, customerID string) (*models.CustomerSummary, error) {
+			return nil, svc.ErrCustomerNotFound
+		},
+	}
+	h := NewReportHandler(service)
+	req := httptest.NewRequest("GET", "/api/v1/customers/nobody/summary", nil)
+	req = mux.SetURLVars(req, map[string]string{"customer_id": "nobody"})
+	w := httptest.NewRecorder()
+	h.CustomerSummary(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+// 6. Test product report parses sort and limit
+func TestProductReport_Success(t *testing.T) {
+	service := &mockReportService{
+		ProductReportFunc: func(ctx context.Context, query *models.ProductReportQuery) (*models.ProductReport, error) {
+			if len(query.Sort) != 1 || query.Sort[0].Field != "units_sold" || !query.Sort[0].Desc {
+				t.Errorf("expected sort -units_sold, got %+v", query.Sort)
+			}
+			if query.Limit != 5 {
+				t.Errorf("expected limit 5, got %d", query.Limit)
+			}
+			if query.IncludeCancelled {
+				t.Error("expected cancelled orders to be excluded by default")
+			}
+			return &models.ProductReport{
+				Limit:    query.Limit,
+				Products: []models.ProductSales{{ProductID: "prod-7", UnitsSold: 12, Revenue: 12000, OrderCount: 4, CustomerCount: 3}},
+			}, nil
+		},
+	}
+	h := NewReportHandler(service)
+	req := httptest.NewRequest("GET", "/api/v1/reports/products?from=2026-01-01&to=2026-01-31&sort=-units_sold&limit=5", nil)
+	w := httptest.NewRecorder()
+	h.ProductReport(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var report models.ProductReport
+	json.NewDecoder(w.Body).Decode(&report)
+	if len(report.Products) != 1 || report.Products[0].UnitsSold != 12 {
+		t.Errorf("unexpected products %+v", report.Products)
+	}
+}
+
+// 7. Test product report rejects sort keys of the order list
+func TestProductReport_InvalidSort(t *testing.T) {
+	h := NewReportHandler(&mockReportService{})
+	req := httptest.NewRequest("GET", "/api/v1/reports/products?from=2026-01-01&to=2026-01-31&sort=created_at&limit=0", nil)
+	w := httptest.NewRecorder()
+	h.ProductReport(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	var body response.ProblemDetails
+	json.NewDecoder(w.Body).Decode(&body)
+	if len(body.Errors) != 2 {
+		t.Errorf("expected errors for sort and limit, got %+v", body.Errors)
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func SetupRoutes(orderHandler *OrderHandler) *mux.Router {
+func SetupRoutes(orderHandler *OrderHandler, reportHandler *ReportHandler, webhookHandler *WebhookHandler) *mux.Router {
 	router := mux.NewRouter()
 
 	// Middleware
@@ -17,9 +17,28 @@ func SetupRoutes(orderHandler *OrderHandler) *mux.Router {
 	// API v1 routes
 	api := router.PathPrefix("/api/v1").Subrouter()
 
-	// Only POST and GET (list) endpoints
 	api.HandleFunc("/orders", orderHandler.CreateOrder).Methods("POST")
 	api.HandleFunc("/orders", orderHandler.ListOrders).Methods("GET")
+	// Registered before /orders/{id}, which would otherwise match them
+	api.HandleFunc("/orders/batch", orderHandler.CreateOrders).Methods("POST")
+	api.HandleFunc("/orders/bulk-status", orderHandler.BulkUpdateStatus).Methods("POST")
+	api.HandleFunc("/orders/export.csv", orderHandler.ExportOrdersCSV).Methods("GET")
+	api.HandleFunc("/orders/stream", orderHandler.StreamOrders).Methods("GET")
+	api.HandleFunc("/orders/{id}", orderHandler.GetOrder).Methods("GET")
+	api.HandleFunc("/orders/{id}/transitions", orderHandler.TransitionOrder).Methods("POST")
+	api.HandleFunc("/orders/{id}/cancel", orderHandler.CancelOrder).Methods("POST")
+	api.HandleFunc("/orders/{id}/history", orderHandler.GetOrderHistory).Methods("GET")
+
+	api.HandleFunc("/reports/sales", reportHandler.SalesReport).Methods("GET")
+	api.HandleFunc("/reports/products", reportHandler.ProductReport).Methods("GET")
+	api.HandleFunc("/customers/{customer_id}/summary", reportHandler.CustomerSummary).Methods("GET")
+
+	api.HandleFunc("/webhooks", webhookHandler.CreateWebhook).Methods("POST")
+	api.HandleFunc("/webhooks", webhookHandler.ListWebhooks).Methods("GET")
+	api.HandleFunc("/webhooks/{id}", webhookHandler.GetWebhook).Methods("GET")
+	api.HandleFunc("/webhooks/{id}", webhookHandler.UpdateWebhook).Methods("PATCH")
+	api.HandleFunc("/webhooks/{id}", webhookHandler.DeleteWebhook).Methods("DELETE")
+	api.HandleFunc("/webhooks/{id}/deliveries", webhookHandler.ListDeliveries).Methods("GET")
 
 	return router
 }
@@ -34,8 +53,9 @@ func loggingMiddleware(next http.Handler) http.Handler {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, Idempotency-Key, Last-Event-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
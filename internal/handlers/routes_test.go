@@ -17,10 +17,23 @@ func TestSetupRoutes(t *testing.T) {
 		ListOrdersFunc: func(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
 			return &models.PaginatedOrders{Orders: []models.Order{}, Total: 0, Page: 1, Limit: 10, TotalPages: 1}, nil
 		},
+		ExportFunc: func(ctx context.Context, filter *models.OrderFilter, includeItems bool, fn func(*models.Order) error) error {
+			return nil
+		},
+	}
+	reports := &mockReportService{
+		SalesReportFunc: func(ctx context.Context, query *models.SalesReportQuery) (*models.SalesReport, error) {
+			return &models.SalesReport{Buckets: []models.SalesBucket{}}, nil
+		},
+	}
+	webhooks := &mockWebhookService{
+		ListFunc: func(ctx context.Context) ([]models.WebhookSubscription, error) {
+			return []models.WebhookSubscription{}, nil
+		},
 	}
 	h := NewOrderHandler(service, 10, 100)
-	router := SetupRoutes(h)
-	
+	router := SetupRoutes(h, NewReportHandler(reports), NewWebhookHandler(webhooks))
+
 	if router == nil {
 		t.Error("expected router to be created")
 	}
@@ -30,7 +43,7 @@ func TestSetupRoutes(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
-	
+
 	if w.Code == http.StatusNotFound {
 		t.Error("POST /api/v1/orders route not found")
 	}
@@ -39,10 +52,46 @@ func TestSetupRoutes(t *testing.T) {
 	req = httptest.NewRequest("GET", "/api/v1/orders", nil)
 	w = httptest.NewRecorder()
 	router.ServeHTTP(w, req)
-	
+
 	if w.Code == http.StatusNotFound {
 		t.Error("GET /api/v1/orders route not found")
 	}
+
+	// Test GET /api/v1/orders/export.csv is not taken for an order ID
+	req = httptest.NewRequest("GET", "/api/v1/orders/export.csv", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("GET /api/v1/orders/export.csv not routed to the export, got %d", w.Code)
+	}
+
+	// Test GET /api/v1/orders/stream is not taken for an order ID
+	req = httptest.NewRequest("GET", "/api/v1/orders/stream", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /api/v1/orders/stream not routed to the stream, got %d", w.Code)
+	}
+
+	// Test GET /api/v1/reports/sales route exists
+	req = httptest.NewRequest("GET", "/api/v1/reports/sales?from=2026-01-01&to=2026-01-31", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code == http.StatusNotFound {
+		t.Error("GET /api/v1/reports/sales route not found")
+	}
+
+	// Test GET /api/v1/webhooks route exists
+	req = httptest.NewRequest("GET", "/api/v1/webhooks", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /api/v1/webhooks route not found, got %d", w.Code)
+	}
 }
 
 // Test CORS middleware sets proper headers
@@ -52,20 +101,20 @@ func TestCorsMiddleware(t *testing.T) {
 	})
 
 	wrapped := corsMiddleware(handler)
-	
+
 	req := httptest.NewRequest("GET", "/test", nil)
 	w := httptest.NewRecorder()
-	
+
 	wrapped.ServeHTTP(w, req)
-	
+
 	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
 		t.Error("expected CORS Allow-Origin header to be set")
 	}
-	
+
 	if w.Header().Get("Access-Control-Allow-Methods") == "" {
 		t.Error("expected CORS Allow-Methods header to be set")
 	}
-	
+
 	if w.Header().Get("Access-Control-Allow-Headers") == "" {
 		t.Error("expected CORS Allow-Headers header to be set")
 	}
@@ -78,12 +127,12 @@ func TestCorsMiddleware_OptionsRequest(t *testing.T) {
 	})
 
 	wrapped := corsMiddleware(handler)
-	
+
 	req := httptest.NewRequest("OPTIONS", "/test", nil)
 	w := httptest.NewRecorder()
-	
+
 	wrapped.ServeHTTP(w, req)
-	
+
 	if w.Code != http.StatusOK {
 		t.Errorf("expected 200 for OPTIONS request, got %d", w.Code)
 	}
@@ -98,16 +147,16 @@ func TestLoggingMiddleware(t *testing.T) {
 	})
 
 	wrapped := loggingMiddleware(handler)
-	
+
 	req := httptest.NewRequest("GET", "/test", nil)
 	w := httptest.NewRecorder()
-	
+
 	wrapped.ServeHTTP(w, req)
-	
+
 	if !handlerCalled {
 		t.Error("expected handler to be called")
 	}
-	
+
 	if w.Code != http.StatusOK {
 		t.Errorf("expected 200, got %d", w.Code)
 	}
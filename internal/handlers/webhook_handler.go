@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/service"
+	"github.com/sabina/orders-api/pkg/response"
+)
+
+// codeInvalidWebhookID is reported when the {id} of a webhook route is not a
+// positive integer
+const codeInvalidWebhookID = "invalid_webhook_id"
+
+// deliveryParams are understood by the delivery log
+var deliveryParams = []string{"status", "limit"}
+
+type WebhookHandler struct {
+	service service.WebhookServiceInterface
+}
+
+func NewWebhookHandler(service service.WebhookServiceInterface) *WebhookHandler {
+	return &WebhookHandler{service: service}
+}
+
+// webhookListResponse wraps the subscription list
+type webhookListResponse struct {
+	Webhooks []models.WebhookSubscription `json:"webhooks"`
+}
+
+// webhookDeliveriesResponse wraps a subscription's delivery log
+type webhookDeliveriesResponse struct {
+	WebhookID  int64                    `json:"webhook_id"`
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+}
+
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var input models.WebhookSubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	sub, err := h.service.CreateSubscription(r.Context(), &input)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, sub)
+}
+
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.service.ListSubscriptions(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, webhookListResponse{Webhooks: subs})
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+
+	sub, err := h.service.GetSubscription(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, sub)
+}
+
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.WebhookSubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidBody, "Invalid request body")
+		return
+	}
+
+	sub, err := h.service.UpdateSubscription(r.Context(), id, &input)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, sub)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteSubscription(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	var errs queryErrors
+	limit := 0
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			errs.add("limit", "out_of_range", "must be a positive integer")
+		}
+	}
+	checkUnknownParams(query, &errs, deliveryParams)
+	if len(errs) > 0 {
+		writeValidationProblem(w, r, "Invalid query parameters", errs)
+		return
+	}
+
+	deliveries, err := h.service.ListDeliveries(r.Context(), id, query.Get("status"), limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, webhookDeliveriesResponse{WebhookID: id, Deliveries: deliveries})
+}
+
+// parseWebhookID reads the {id} route variable, writing a 400 response when
+// it is not a positive integer
+func parseWebhookID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id < 1 {
+		writeProblem(w, r, http.StatusBadRequest, codeInvalidWebhookID, "Invalid webhook ID")
+		return 0, false
+	}
+	return id, true
+}
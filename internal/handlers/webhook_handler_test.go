@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sabina/orders-api/internal/models"
+	svc "github.com/sabina/orders-api/internal/service"
+)
+
+type mockWebhookService struct {
+	CreateFunc     func(ctx context.Context, input *models.WebhookSubscriptionInput) (*models.WebhookSubscription, error)
+	GetFunc        func(ctx context.Context, id int64) (*models.WebhookSubscription, error)
+	ListFunc       func(ctx context.Context) ([]models.WebhookSubscription, error)
+	UpdateFunc     func(ctx context.Context, id int64, input *models.WebhookSubscriptionInput) (*models.WebhookSubscription, error)
+	DeleteFunc     func(ctx context.Context, id int64) error
+	DeliveriesFunc func(ctx context.Context, subscriptionID int64, status string, limit int) ([]models.WebhookDelivery, error)
+}
+
+func (m *mockWebhookService) CreateSubscription(ctx context.Context, input *models.WebhookSubscriptionInput) (*models.WebhookSubscription, error) {
+	return m.CreateFunc(ctx, input)
+}
+func (m *mockWebhookService) GetSubscription(ctx context.Context, id int64) (*models.WebhookSubscription, error) {
+	return m.GetFunc(ctx, id)
+}
+func (m *mockWebhookService) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	return m.ListFunc(ctx)
+}
+func (m *mockWebhookService) UpdateSubscription(ctx context.Context, id int64, input *models.WebhookSubscriptionInput) (*models.WebhookSubscription, error) {
+	return m.UpdateFunc(ctx, id, input)
+}
+func (m *mockWebhookService) DeleteSubscription(ctx context.Context, id int64) error {
+	return m.DeleteFunc(ctx, id)
+}
+func (m *mockWebhookService) ListDeliveries(ctx context.Context, subscriptionID int64, status string, limit int) ([]models.WebhookDelivery, error) {
+	return m.DeliveriesFunc(ctx, subscriptionID, status, limit)
+}
+
+// 1. Test creating a webhook returns 201 with its secret
+func TestCreateWebhook_Success(t *testing.T) {
+	service := &mockWebhookService{
+		CreateFunc: func(ctx context.Context, input *models.WebhookSubscriptionInput) (*models.WebhookSubscription, error) {
+			if input.URL == nil || *input.URL != "https://example.com/hooks" || len(input.EventTypes) != 1 {
+				t.Errorf("unexpected input %+v", input)
+			}
+			return &models.WebhookSubscription{ID: 1, URL: *input.URL, EventTypes: input.EventTypes, Secret: "generated", Active: true}, nil
+		},
+	}
+	h := NewWebhookHandler(service)
+	body := `{"url":"https://example.com/hooks","event_types":["order.created"]}`
+	req := httptest.NewRequest("POST", "/api/v1/webhooks", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.CreateWebhook(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+	var sub models.WebhookSubscription
+	json.Unmarshal(w.Body.Bytes(), &sub)
+	if sub.Secret != "generated" {
+		t.Errorf("expected the secret in the create response, got %+v", sub)
+	}
+}
+
+// 2. Test an unknown webhook is reported as not found
+func TestGetWebhook_NotFound(t *testing.T) {
+	service := &mockWebhookService{
+		GetFunc: func(ctx context.Context, id int64) (*models.WebhookSubscription, error) {
+			return nil, svc.ErrSubscriptionNotFound
+		},
+	}
+	h := NewWebhookHandler(service)
+	req := httptest.NewRequest("GET", "/api/v1/webhooks/9", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "9"})
+	w := httptest.NewRecorder()
+	h.GetWebhook(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+// 3. Test deleting a webhook returns 204
+func TestDeleteWebhook_Success(t *testing.T) {
+	service := &mockWebhookService{
+		DeleteFunc: func(ctx context.Context, id int64) error {
+			if id != 3 {
+				t.Errorf("expected id 3, got %d", id)
+			}
+			return nil
+		},
+	}
+	h := NewWebhookHandler(service)
+	req := httptest.NewRequest("DELETE", "/api/v1/webhooks/3", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "3"})
+	w := httptest.NewRecorder()
+	h.DeleteWebhook(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", w.Code)
+	}
+}
+
+// 4. Test the delivery log passes the status filter and limit
+func TestListDeliveries_Params(t *testing.T) {
+	service := &mockWebhookService{
+		DeliveriesFunc: func(ctx context.Context, subscriptionID int64, status string, limit int) ([]models.WebhookDelivery, error) {
+			if subscriptionID != 2 || status != "dead" || limit != 5 {
+				t.Errorf("unexpected arguments %d %q %d", subscriptionID, status, limit)
+			}
+			return []models.WebhookDelivery{{ID: 7, SubscriptionID: 2, Status: "dead", Attempts: 8}}, nil
+		},
+	}
+	h := NewWebhookHandler(service)
+	req := httptest.NewRequest("GET", "/api/v1/webhooks/2/deliveries?status=dead&limit=5", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "2"})
+	w := httptest.NewRecorder()
+	h.ListDeliveries(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var resp webhookDeliveriesResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.WebhookID != 2 || len(resp.Deliveries) != 1 || resp.Deliveries[0].Attempts != 8 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+// 5. Test an invalid webhook ID is rejected
+func TestListDeliveries_InvalidID(t *testing.T) {
+	h := NewWebhookHandler(&mockWebhookService{})
+	req := httptest.NewRequest("GET", "/api/v1/webhooks/abc/deliveries", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "abc"})
+	w := httptest.NewRecorder()
+	h.ListDeliveries(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,26 @@
+package models
+
+// BatchMode decides how a batch of orders is created when some of them fail
+type BatchMode string
+
+const (
+	// BatchAtomic creates every order of the batch or none of them
+	BatchAtomic BatchMode = "atomic"
+	// BatchPartial creates the valid orders and reports the others
+	BatchPartial BatchMode = "partial"
+)
+
+func (m BatchMode) IsValid() bool {
+	switch m {
+	case BatchAtomic, BatchPartial:
+		return true
+	}
+	return false
+}
+
+// BatchCreateRequest is the body of a batch order creation. Mode defaults to
+// atomic.
+type BatchCreateRequest struct {
+	Mode   BatchMode `json:"mode"`
+	Orders []Order   `json:"orders"`
+}
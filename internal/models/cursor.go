@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in the (created_at DESC, id DESC) ordering of orders.
+// Clients treat its encoded form as opaque.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"i"`
+	// Before pages towards newer orders, i.e. to the previous page
+	Before bool `json:"b,omitempty"`
+}
+
+// Encode returns the cursor as a URL-safe opaque string
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a string produced by Cursor.Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID < 1 || c.CreatedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
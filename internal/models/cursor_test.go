@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	c := Cursor{CreatedAt: time.Date(2026, 2, 9, 10, 30, 0, 123456000, time.UTC), ID: 42, Before: true}
+	decoded, err := DecodeCursor(c.Encode())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !decoded.CreatedAt.Equal(c.CreatedAt) || decoded.ID != 42 || !decoded.Before {
+		t.Errorf("expected %+v, got %+v", c, decoded)
+	}
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	for _, s := range []string{"not-base64!", "e30", ""} {
+		if _, err := DecodeCursor(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestPaginatedOrders_MarshalJSON(t *testing.T) {
+	legacy, _ := json.Marshal(PaginatedOrders{Orders: []Order{}, Page: 1, Limit: 10})
+	if !strings.Contains(string(legacy), `"total_pages":0`) || strings.Contains(string(legacy), "cursor") {
+		t.Errorf("unexpected legacy page JSON: %s", legacy)
+	}
+
+	keyset, _ := json.Marshal(PaginatedOrders{Orders: []Order{}, Limit: 10, Keyset: true, NextCursor: "abc"})
+	if !strings.Contains(string(keyset), `"next_cursor":"abc"`) || !strings.Contains(string(keyset), `"prev_cursor":null`) {
+		t.Errorf("unexpected cursor page JSON: %s", keyset)
+	}
+	if strings.Contains(string(keyset), "total") {
+		t.Errorf("cursor page should not include totals: %s", keyset)
+	}
+}
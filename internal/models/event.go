@@ -0,0 +1,126 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event types emitted for orders
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+)
+
+// EventTypes lists every event type a webhook can subscribe to
+var EventTypes = []string{EventOrderCreated, EventOrderStatusChanged}
+
+// IsEventType reports whether t is one of EventTypes
+func IsEventType(t string) bool {
+	for _, known := range EventTypes {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a domain event as delivered to subscribers. ID is unique per event
+// and stays the same across delivery attempts.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// OrderEventData is the data of order events. PreviousStatus is only set on
+// order.status_changed.
+type OrderEventData struct {
+	Order          *Order `json:"order"`
+	PreviousStatus string `json:"previous_status,omitempty"`
+}
+
+// NewEvent builds an event of the given type occurring now, with a random ID
+func NewEvent(eventType string, data interface{}) (*Event, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate event ID: %w", err)
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	return &Event{ID: hex.EncodeToString(id), Type: eventType, OccurredAt: time.Now().UTC(), Data: payload}, nil
+}
+
+// OutboxEvent is an event with its position in the outbox. Seq grows with
+// each event recorded. Attempts counts failed publishes.
+type OutboxEvent struct {
+	Seq      int64
+	Attempts int
+	Event    Event
+}
+
+// OrderChange is an order event decoded for streaming to clients. Position
+// is how far the stream has got once the change is delivered.
+type OrderChange struct {
+	Seq      int64
+	Type     string
+	Data     OrderEventData
+	Position StreamPosition
+}
+
+// MaxPendingSeqs caps StreamPosition.Pending
+const MaxPendingSeqs = 64
+
+// StreamPosition is how far an order stream has got: every change up to Seq
+// except the Pending ones, which had not been committed yet. Seqs are
+// allocated before commit, so those can still arrive after higher ones.
+type StreamPosition struct {
+	Seq     int64
+	Pending []int64
+}
+
+// String formats the position as an SSE event id: the seq, followed by the
+// pending seqs if any, as in "13" or "13:10,12"
+func (p StreamPosition) String() string {
+	if len(p.Pending) == 0 {
+		return strconv.FormatInt(p.Seq, 10)
+	}
+	pending := make([]string, len(p.Pending))
+	for i, seq := range p.Pending {
+		pending[i] = strconv.FormatInt(seq, 10)
+	}
+	return strconv.FormatInt(p.Seq, 10) + ":" + strings.Join(pending, ",")
+}
+
+// ParseStreamPosition parses a position formatted by String
+func ParseStreamPosition(s string) (StreamPosition, error) {
+	seqPart, pendingPart, hasPending := strings.Cut(s, ":")
+	seq, err := strconv.ParseInt(seqPart, 10, 64)
+	if err != nil || seq < 0 {
+		return StreamPosition{}, errors.New("invalid seq")
+	}
+	position := StreamPosition{Seq: seq}
+	if !hasPending {
+		return position, nil
+	}
+	parts := strings.Split(pendingPart, ",")
+	if len(parts) > MaxPendingSeqs {
+		return StreamPosition{}, errors.New("too many pending seqs")
+	}
+	for _, part := range parts {
+		pending, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || pending < 1 || pending >= seq {
+			return StreamPosition{}, errors.New("invalid pending seq")
+		}
+		position.Pending = append(position.Pending, pending)
+	}
+	return position, nil
+}
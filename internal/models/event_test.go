@@ -0,0 +1,24 @@
+package models
+
+import "testing"
+
+func TestStreamPosition_RoundTrip(t *testing.T) {
+	for _, id := range []string{"0", "13", "13:12", "13:9,12"} {
+		position, err := ParseStreamPosition(id)
+		if err != nil {
+			t.Errorf("ParseStreamPosition(%q): unexpected error: %v", id, err)
+			continue
+		}
+		if got := position.String(); got != id {
+			t.Errorf("ParseStreamPosition(%q).String() = %q", id, got)
+		}
+	}
+}
+
+func TestParseStreamPosition_Invalid(t *testing.T) {
+	for _, id := range []string{"", "abc", "-1", "13:", "13:13", "13:0", "13:x"} {
+		if _, err := ParseStreamPosition(id); err == nil {
+			t.Errorf("ParseStreamPosition(%q): expected an error", id)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// IdempotencyRecord stores the outcome of a request made with an
+// Idempotency-Key header. ResponseStatus is zero while the original request
+// is still being processed, and LockedUntil is when its reservation lapses.
+type IdempotencyRecord struct {
+	Key            string
+	RequestHash    string
+	ResponseStatus int
+	ResponseBody   []byte
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	LockedUntil    time.Time
+}
+
+// Completed reports whether a response has been stored for the key
+func (r *IdempotencyRecord) Completed() bool {
+	return r.ResponseStatus != 0
+}
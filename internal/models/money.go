@@ -0,0 +1,188 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact monetary amount held in minor units (cents). It reads from
+// and writes to DECIMAL(10, 2) columns and marshals to JSON as an exact
+// decimal number such as 199.99, so values never pass through float64.
+type Money int64
+
+// maxMoneyDigits bounds the number of digits accepted when parsing so the
+// result always fits in an int64
+const maxMoneyDigits = 18
+
+var errInvalidMoney = errors.New("invalid amount")
+
+// ParseMoney parses a decimal string such as "12", "12.5" or "-0.99". More
+// than two decimal places are rejected unless the extra digits are zero.
+func ParseMoney(s string) (Money, error) {
+	return parseMoney(s, false)
+}
+
+// parseMoney parses a decimal string into cents. When round is set, digits
+// beyond the second decimal place are rounded half away from zero instead of
+// being rejected, which is what aggregates read back from Postgres need.
+func parseMoney(s string, round bool) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("%w: %q", errInvalidMoney, s)
+	}
+	if !isDigits(whole) || !isDigits(frac) || len(whole) > maxMoneyDigits-2 {
+		return 0, fmt.Errorf("%w: %q", errInvalidMoney, s)
+	}
+
+	roundUp := false
+	if len(frac) > 2 {
+		extra := frac[2:]
+		if !round && strings.Trim(extra, "0") != "" {
+			return 0, fmt.Errorf("%w: %q has more than two decimal places", errInvalidMoney, s)
+		}
+		roundUp = extra[0] >= '5'
+		frac = frac[:2]
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	cents, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", errInvalidMoney, s)
+	}
+	if roundUp {
+		cents++
+	}
+	if negative {
+		cents = -cents
+	}
+	return Money(cents), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the amount with exactly two decimal places
+func (m Money) String() string {
+	cents := int64(m)
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Mul returns the amount multiplied by a quantity
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// DivRound divides the amount by n, rounding half away from zero. It is used
+// for averages and returns zero when n is zero.
+func (m Money) DivRound(n int64) Money {
+	if n == 0 {
+		return 0
+	}
+	q, r := int64(m)/n, int64(m)%n
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= abs64(n) {
+		if (int64(m) < 0) != (n < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Money(q)
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// MarshalJSON writes the amount as an exact JSON number
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a quoted decimal string
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("%w: %q must not use exponent notation", errInvalidMoney, s)
+	}
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for DECIMAL and NUMERIC columns
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		parsed, err := parseMoney(string(v), true)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case string:
+		parsed, err := parseMoney(v, true)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case int64:
+		*m = Money(v * 100)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
+
+// Value implements driver.Valuer, sending the amount as a decimal string so
+// Postgres stores it without rounding
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
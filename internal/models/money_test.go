@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"12", 1200, false},
+		{"12.5", 1250, false},
+		{"0.10", 10, false},
+		{".99", 99, false},
+		{"-3.07", -307, false},
+		{"1.230", 123, false},
+		{"1.234", 0, true},
+		{"abc", 0, true},
+		{"", 0, true},
+		{"1.2.3", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMoney(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	tests := map[Money]string{0: "0.00", 5: "0.05", 1999: "19.99", -5: "-0.05", -12345: "-123.45"}
+	for m, want := range tests {
+		if got := m.String(); got != want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(m), got, want)
+		}
+	}
+}
+
+func TestMoney_JSONRoundTrip(t *testing.T) {
+	var item OrderItem
+	if err := json.Unmarshal([]byte(`{"price": 0.1, "quantity": 1}`), &item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var other OrderItem
+	if err := json.Unmarshal([]byte(`{"price": "0.2"}`), &other); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sum := item.Price + other.Price
+	data, _ := json.Marshal(sum)
+	if string(data) != "0.30" {
+		t.Errorf("expected 0.30, got %s", data)
+	}
+	if err := json.Unmarshal([]byte(`{"price": 1e2}`), &item); err == nil {
+		t.Error("expected exponent notation to be rejected")
+	}
+}
+
+func TestMoney_Scan(t *testing.T) {
+	var m Money
+	if err := m.Scan([]byte("1234.5678")); err != nil || m != 123457 {
+		t.Errorf("expected 123457, got %d (err %v)", m, err)
+	}
+	if err := m.Scan(nil); err != nil || m != 0 {
+		t.Errorf("expected 0 for NULL, got %d (err %v)", m, err)
+	}
+}
+
+func TestMoney_DivRound(t *testing.T) {
+	if got := Money(1000).DivRound(3); got != 333 {
+		t.Errorf("expected 333, got %d", got)
+	}
+	if got := Money(1001).DivRound(2); got != 501 {
+		t.Errorf("expected 501, got %d", got)
+	}
+	if got := Money(100).DivRound(0); got != 0 {
+		t.Errorf("expected 0 when dividing by zero, got %d", got)
+	}
+}
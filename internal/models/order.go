@@ -1,25 +1,35 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
 type Order struct {
-	ID           int64      `json:"id"`
-	CustomerID   string     `json:"customer_id"`
-	TotalAmount  float64    `json:"total_amount"`
-	Status       string     `json:"status"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
-	Items        []OrderItem `json:"items,omitempty"`
+	ID                 int64       `json:"id"`
+	CustomerID         string      `json:"customer_id"`
+	TotalAmount        Money       `json:"total_amount"`
+	Currency           string      `json:"currency"`
+	Status             string      `json:"status"`
+	CancellationReason *string     `json:"cancellation_reason,omitempty"`
+	CancellationNote   string      `json:"cancellation_note,omitempty"`
+	CancelledAt        *time.Time  `json:"cancelled_at,omitempty"`
+	Version            int         `json:"version"`
+	CreatedAt          time.Time   `json:"created_at"`
+	UpdatedAt          time.Time   `json:"updated_at"`
+	Items              []OrderItem `json:"items,omitempty"`
+	// ItemCount is set on list results, whether or not Items were loaded
+	ItemCount *int `json:"item_count,omitempty"`
 }
 
 type OrderItem struct {
-	ID        int64   `json:"id"`
-	OrderID   int64   `json:"order_id"`
-	ProductID string  `json:"product_id"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
+	ID        int64  `json:"id"`
+	OrderID   int64  `json:"order_id"`
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	Price     Money  `json:"price"`
+	// Currency always equals the order's currency; it may be omitted on create
+	Currency string `json:"currency,omitempty"`
 }
 
 type OrderStatus string
@@ -32,6 +42,9 @@ const (
 	StatusCancelled  OrderStatus = "cancelled"
 )
 
+// OrderStatuses lists every status in lifecycle order
+var OrderStatuses = []OrderStatus{StatusPending, StatusProcessing, StatusShipped, StatusDelivered, StatusCancelled}
+
 func (s OrderStatus) IsValid() bool {
 	switch s {
 	case StatusPending, StatusProcessing, StatusShipped, StatusDelivered, StatusCancelled:
@@ -40,18 +53,174 @@ func (s OrderStatus) IsValid() bool {
 	return false
 }
 
+type CancellationReason string
+
+const (
+	CancellationCustomerRequest CancellationReason = "customer_request"
+	CancellationFraud           CancellationReason = "fraud"
+	CancellationOutOfStock      CancellationReason = "out_of_stock"
+	CancellationOther           CancellationReason = "other"
+)
+
+func (c CancellationReason) IsValid() bool {
+	switch c {
+	case CancellationCustomerRequest, CancellationFraud, CancellationOutOfStock, CancellationOther:
+		return true
+	}
+	return false
+}
+
+// SystemActor is recorded as the actor of status changes that were not
+// attributed to anyone, such as order creation
+const SystemActor = "system"
+
+// StatusUpdate describes a requested change of an order's status
+type StatusUpdate struct {
+	Status string `json:"status"`
+	Actor  string `json:"actor"`
+	Reason string `json:"reason"`
+
+	// Only used when moving to cancelled
+	CancellationReason string `json:"cancellation_reason,omitempty"`
+	CancellationNote   string `json:"cancellation_note,omitempty"`
+
+	// ExpectedVersion, taken from If-Match, makes the update fail if the
+	// order has changed since the client read it. Nil skips the check.
+	ExpectedVersion *int `json:"-"`
+}
+
+// BulkStatusRequest is the body of a bulk status change. Orders are picked by
+// IDs or, when IDs is empty, by an OrderFilter taken from the query string.
+type BulkStatusRequest struct {
+	IDs []int64 `json:"ids"`
+	StatusUpdate
+}
+
+// CancelRequest is the body of a cancel order request
+type CancelRequest struct {
+	ReasonCode string `json:"reason_code"`
+	Note       string `json:"note"`
+	Actor      string `json:"actor"`
+
+	ExpectedVersion *int `json:"-"`
+}
+
+// StatusHistoryEntry is one step in an order's status timeline. FromStatus is
+// nil for the entry written when the order was created.
+type StatusHistoryEntry struct {
+	ID         int64     `json:"id"`
+	OrderID    int64     `json:"order_id"`
+	FromStatus *string   `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Actor      string    `json:"actor"`
+	Reason     string    `json:"reason"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// OrderFilter narrows an order listing. Slice fields match an order when any
+// of their values match; filters are combined with AND.
 type OrderFilter struct {
-	CustomerID *string
-	Status     *string
-	FromDate   *time.Time
-	ToDate     *time.Time
-	MinAmount  *float64
-	MaxAmount  *float64
+	IDs                []int64
+	CustomerIDs        []string
+	Statuses           []string
+	ProductIDs         []string // orders containing at least one of these products
+	CancellationReason *string
+	Currency           *string
+	FromDate           *time.Time
+	ToDate             *time.Time
+	UpdatedSince       *time.Time
+	MinAmount          *Money
+	MaxAmount          *Money
+}
+
+// IsEmpty reports whether the filter matches every order
+func (f *OrderFilter) IsEmpty() bool {
+	return len(f.IDs) == 0 && len(f.CustomerIDs) == 0 && len(f.Statuses) == 0 && len(f.ProductIDs) == 0 &&
+		f.CancellationReason == nil && f.Currency == nil && f.FromDate == nil && f.ToDate == nil &&
+		f.UpdatedSince == nil && f.MinAmount == nil && f.MaxAmount == nil
+}
+
+// Matches reports whether order passes the filter, with the same meaning as
+// the filter has when listing orders. Product filters need order.Items.
+func (f *OrderFilter) Matches(order *Order) bool {
+	if len(f.IDs) > 0 && !containsID(f.IDs, order.ID) {
+		return false
+	}
+	if len(f.CustomerIDs) > 0 && !containsString(f.CustomerIDs, order.CustomerID) {
+		return false
+	}
+	if len(f.Statuses) > 0 && !containsString(f.Statuses, order.Status) {
+		return false
+	}
+	if len(f.ProductIDs) > 0 {
+		found := false
+		for _, item := range order.Items {
+			if containsString(f.ProductIDs, item.ProductID) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.CancellationReason != nil && (order.CancellationReason == nil || *order.CancellationReason != *f.CancellationReason) {
+		return false
+	}
+	if f.Currency != nil && order.Currency != *f.Currency {
+		return false
+	}
+	if f.FromDate != nil && order.CreatedAt.Before(*f.FromDate) {
+		return false
+	}
+	if f.ToDate != nil && order.CreatedAt.After(*f.ToDate) {
+		return false
+	}
+	if f.UpdatedSince != nil && order.UpdatedAt.Before(*f.UpdatedSince) {
+		return false
+	}
+	if f.MinAmount != nil && order.TotalAmount < *f.MinAmount {
+		return false
+	}
+	if f.MaxAmount != nil && order.TotalAmount > *f.MaxAmount {
+		return false
+	}
+	return true
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
 }
 
 type Pagination struct {
 	Page  int
 	Limit int
+
+	// Sort overrides the default newest-first order; id is always appended as
+	// a tiebreaker
+	Sort []SortField
+
+	// Keyset selects cursor pagination instead of page/limit. Cursor is nil
+	// for the first (newest) page.
+	Keyset bool
+	Cursor *Cursor
+
+	// IncludeItems loads each listed order's line items
+	IncludeItems bool
 }
 
 type PaginatedOrders struct {
@@ -60,4 +229,34 @@ type PaginatedOrders struct {
 	Page       int     `json:"page"`
 	Limit      int     `json:"limit"`
 	TotalPages int     `json:"total_pages"`
+
+	// Only set for cursor pagination
+	Keyset     bool   `json:"-"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// cursorPage is the JSON shape of a cursor-paginated result, which has no
+// total count or page number
+type cursorPage struct {
+	Orders     []Order `json:"orders"`
+	Limit      int     `json:"limit"`
+	NextCursor *string `json:"next_cursor"`
+	PrevCursor *string `json:"prev_cursor"`
+}
+
+func (p PaginatedOrders) MarshalJSON() ([]byte, error) {
+	if !p.Keyset {
+		type legacyPage PaginatedOrders
+		return json.Marshal(legacyPage(p))
+	}
+
+	page := cursorPage{Orders: p.Orders, Limit: p.Limit}
+	if p.NextCursor != "" {
+		page.NextCursor = &p.NextCursor
+	}
+	if p.PrevCursor != "" {
+		page.PrevCursor = &p.PrevCursor
+	}
+	return json.Marshal(page)
 }
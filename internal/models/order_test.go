@@ -0,0 +1,45 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOrderFilter_Matches(t *testing.T) {
+	created := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	fraud := "fraud"
+	usd := "USD"
+	day := func(d int) *time.Time { date := time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC); return &date }
+	amount := func(m Money) *Money { return &m }
+
+	order := &Order{
+		ID: 7, CustomerID: "cust-1", Status: "cancelled", Currency: "USD", TotalAmount: 2500,
+		CancellationReason: &fraud, CreatedAt: created, UpdatedAt: created,
+		Items: []OrderItem{{ProductID: "prod-1"}, {ProductID: "prod-2"}},
+	}
+	tests := []struct {
+		name   string
+		filter OrderFilter
+		want   bool
+	}{
+		{"empty", OrderFilter{}, true},
+		{"id", OrderFilter{IDs: []int64{3, 7}}, true},
+		{"other id", OrderFilter{IDs: []int64{3}}, false},
+		{"customer", OrderFilter{CustomerIDs: []string{"cust-1"}}, true},
+		{"other status", OrderFilter{Statuses: []string{"pending", "shipped"}}, false},
+		{"product", OrderFilter{ProductIDs: []string{"prod-2"}}, true},
+		{"other product", OrderFilter{ProductIDs: []string{"prod-9"}}, false},
+		{"cancellation reason", OrderFilter{CancellationReason: &fraud}, true},
+		{"currency", OrderFilter{Currency: &usd}, true},
+		{"date range", OrderFilter{FromDate: day(10), ToDate: day(11)}, true},
+		{"created after to_date", OrderFilter{ToDate: day(10)}, false},
+		{"updated since", OrderFilter{UpdatedSince: day(11)}, false},
+		{"amount range", OrderFilter{MinAmount: amount(2500), MaxAmount: amount(2500)}, true},
+		{"below min amount", OrderFilter{MinAmount: amount(2501)}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Matches(order); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
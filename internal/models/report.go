@@ -0,0 +1,128 @@
+package models
+
+import "time"
+
+// ReportInterval is the width of a report's time buckets
+type ReportInterval string
+
+const (
+	IntervalDay   ReportInterval = "day"
+	IntervalWeek  ReportInterval = "week"
+	IntervalMonth ReportInterval = "month"
+)
+
+func (i ReportInterval) IsValid() bool {
+	switch i {
+	case IntervalDay, IntervalWeek, IntervalMonth:
+		return true
+	}
+	return false
+}
+
+// SalesGroupFields are the order columns a sales report can be grouped by
+var SalesGroupFields = []string{"status", "customer_id"}
+
+// SalesReportQuery describes a sales report. From and To are inclusive dates;
+// buckets start at the beginning of the interval containing From (weeks start
+// on Monday) and run through the one containing To.
+type SalesReportQuery struct {
+	Interval ReportInterval
+	From     time.Time
+	To       time.Time
+	GroupBy  string
+	Filter   *OrderFilter
+
+	// IncludeCancelled counts cancelled orders even when Filter does not ask
+	// for them by status
+	IncludeCancelled bool
+}
+
+// SalesMetrics are the aggregates reported for each bucket and group
+type SalesMetrics struct {
+	OrderCount        int64 `json:"order_count"`
+	GrossRevenue      Money `json:"gross_revenue"`
+	AverageOrderValue Money `json:"average_order_value"`
+	ItemUnits         int64 `json:"item_units"`
+}
+
+// SalesGroup holds the metrics of one group_by value within a bucket
+type SalesGroup struct {
+	Key string `json:"key"`
+	SalesMetrics
+}
+
+// SalesBucket holds the metrics of one time bucket. Groups is only set when
+// the report is grouped and the bucket has orders.
+type SalesBucket struct {
+	Start time.Time `json:"start"`
+	SalesMetrics
+	Groups []SalesGroup `json:"groups,omitempty"`
+}
+
+// SalesReport is a time series of sales metrics with one bucket per interval,
+// including intervals without orders
+type SalesReport struct {
+	Interval ReportInterval `json:"interval"`
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Currency string         `json:"currency,omitempty"`
+	GroupBy  string         `json:"group_by,omitempty"`
+	Buckets  []SalesBucket  `json:"buckets"`
+}
+
+// CustomerSpend is a customer's spend in one currency, over orders that were
+// not cancelled
+type CustomerSpend struct {
+	Currency          string `json:"currency"`
+	OrderCount        int64  `json:"order_count"`
+	LifetimeSpend     Money  `json:"lifetime_spend"`
+	AverageOrderValue Money  `json:"average_order_value"`
+}
+
+// CustomerSummary describes a customer's whole order history. Spend is
+// broken down by currency because amounts in different currencies cannot be
+// added up.
+type CustomerSummary struct {
+	CustomerID       string                `json:"customer_id"`
+	TotalOrders      int64                 `json:"total_orders"`
+	FirstOrderAt     time.Time             `json:"first_order_at"`
+	LastOrderAt      time.Time             `json:"last_order_at"`
+	StatusCounts     map[OrderStatus]int64 `json:"status_counts"`
+	CancellationRate float64               `json:"cancellation_rate"`
+	Spend            []CustomerSpend       `json:"spend"`
+}
+
+// SortableProductFields are the keys accepted by the product report's sort
+var SortableProductFields = []string{"units_sold", "revenue", "order_count", "customer_count", "product_id"}
+
+// ProductReportQuery describes a product sales report over the inclusive
+// From and To dates, keeping the first Limit products in Sort order
+type ProductReportQuery struct {
+	From   time.Time
+	To     time.Time
+	Sort   []SortField
+	Limit  int
+	Filter *OrderFilter
+
+	// IncludeCancelled counts items of cancelled orders even when Filter does
+	// not ask for them by status
+	IncludeCancelled bool
+}
+
+// ProductSales aggregates the line items of one product
+type ProductSales struct {
+	ProductID     string `json:"product_id"`
+	UnitsSold     int64  `json:"units_sold"`
+	Revenue       Money  `json:"revenue"`
+	OrderCount    int64  `json:"order_count"`
+	CustomerCount int64  `json:"customer_count"`
+}
+
+// ProductReport ranks products by sales
+type ProductReport struct {
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Currency string         `json:"currency,omitempty"`
+	Limit    int            `json:"limit"`
+	Products []ProductSales `json:"products"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SortableOrderFields are the keys accepted by the sort query parameter
+var SortableOrderFields = []string{"created_at", "updated_at", "total_amount", "status", "customer_id"}
+
+// SortField orders results by one field; Desc reverses the order
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort parses a comma-separated list of order sort keys, each optionally
+// prefixed with "-" for descending order, e.g. "-total_amount,created_at".
+// Unknown or repeated keys are rejected.
+func ParseSort(s string) ([]SortField, error) {
+	return ParseSortFields(s, SortableOrderFields)
+}
+
+// ParseSortFields is ParseSort for a list of keys other than the order fields
+func ParseSortFields(s string, allowed []string) ([]SortField, error) {
+	var fields []SortField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		desc := strings.HasPrefix(part, "-")
+		name := strings.TrimPrefix(strings.TrimPrefix(part, "-"), "+")
+		if name == "" {
+			return nil, fmt.Errorf("empty sort key in %q", s)
+		}
+		if !isAllowedSortField(allowed, name) {
+			return nil, fmt.Errorf("unknown sort key %q; allowed: %s", name, strings.Join(allowed, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("sort key %q given more than once", name)
+		}
+		seen[name] = true
+		fields = append(fields, SortField{Field: name, Desc: desc})
+	}
+	return fields, nil
+}
+
+func isAllowedSortField(allowed []string, name string) bool {
+	for _, field := range allowed {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package models
+
+import "testing"
+
+func TestParseSort(t *testing.T) {
+	fields, err := ParseSort("-total_amount, created_at")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []SortField{{Field: "total_amount", Desc: true}, {Field: "created_at"}}
+	if len(fields) != len(want) || fields[0] != want[0] || fields[1] != want[1] {
+		t.Errorf("expected %+v, got %+v", want, fields)
+	}
+}
+
+func TestParseSort_Invalid(t *testing.T) {
+	for _, s := range []string{"", "price", "created_at;DROP TABLE orders", "status,-status", "created_at,"} {
+		if _, err := ParseSort(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
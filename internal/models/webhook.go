@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookSubscription asks for events of the given types to be POSTed to URL.
+// Secret signs each delivery; it is only returned when the subscription is
+// created.
+type WebhookSubscription struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhookSubscriptionInput is the body of a subscription create or update.
+// Fields left nil keep their current value on update.
+type WebhookSubscriptionInput struct {
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     *string  `json:"secret"`
+	Active     *bool    `json:"active"`
+}
+
+// Webhook delivery states. A pending delivery is waiting for its next attempt;
+// a dead one has used up its attempts and will not be retried.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event queued for one subscription, with the outcome
+// of its latest attempt
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+
+	// URL and Secret of the subscription, set on deliveries claimed for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// DeliveryAttempt records the outcome of sending a delivery. RetryAfter is
+// nil when the delivery succeeded or will not be retried.
+type DeliveryAttempt struct {
+	Status     string
+	StatusCode *int
+	Error      string
+	RetryAfter *time.Duration
+}
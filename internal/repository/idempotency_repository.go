@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+)
+
+// ErrReservationLost is returned when a reservation has been taken over by
+// another request after its lease ran out
+var ErrReservationLost = errors.New("idempotency key reservation lost")
+
+type IdempotencyRepository interface {
+	// Reserve claims key for a new request. It returns the stored record and
+	// false if the key is already held by an unexpired request, or the newly
+	// created record and true otherwise.
+	// The key expires ttl after it is reserved. Until it is completed it is
+	// only held for lease; after that a new request may take it over.
+	Reserve(ctx context.Context, key, requestHash string, ttl, lease time.Duration) (*models.IdempotencyRecord, bool, error)
+	// Complete and Release act on the reservation of key that lasts until
+	// lockedUntil, as returned by Reserve. Complete returns
+	// ErrReservationLost when another request holds the key by now.
+	Complete(ctx context.Context, key string, lockedUntil time.Time, status int, body []byte) error
+	Release(ctx context.Context, key string, lockedUntil time.Time) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
@@ -2,11 +2,62 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/sabina/orders-api/internal/models"
 )
 
+// ErrOrderNotFound is returned when no order exists with the requested ID
+var ErrOrderNotFound = errors.New("order not found")
+
+// VersionConflictError is returned when an update expected a version of the
+// order that is no longer current. CurrentVersion is zero when unknown.
+type VersionConflictError struct {
+	OrderID         int64
+	ExpectedVersion int
+	CurrentVersion  int
+}
+
+func (e *VersionConflictError) Error() string {
+	if e.CurrentVersion == 0 {
+		return fmt.Sprintf("order %d is no longer at version %d", e.OrderID, e.ExpectedVersion)
+	}
+	return fmt.Sprintf("order %d is at version %d, not %d", e.OrderID, e.CurrentVersion, e.ExpectedVersion)
+}
+
+// ConstraintError is returned when the database rejects an order's data,
+// for instance a value too long for its column. Reason describes the problem
+// without the database's own message.
+type ConstraintError struct {
+	Reason string
+	Err    error
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Reason
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
 type OrderRepository interface {
 	Create(ctx context.Context, order *models.Order) error
+	// CreateBatch inserts orders in one transaction. When atomic is set any
+	// failure rolls back the whole batch and is returned; otherwise a failed
+	// order is skipped and its error reported at its index of the slice.
+	CreateBatch(ctx context.Context, orders []*models.Order, atomic bool) ([]error, error)
+	GetByID(ctx context.Context, id int64) (*models.Order, error)
+	// UpdateStatus locks the order row, passes the current state to check and,
+	// if check returns nil, applies the update in the same transaction. It
+	// returns a *VersionConflictError if update.ExpectedVersion is stale.
+	UpdateStatus(ctx context.Context, id int64, update *models.StatusUpdate, check func(current *models.Order) error) (*models.Order, error)
+	GetStatusHistory(ctx context.Context, orderID int64) ([]models.StatusHistoryEntry, error)
+	ListCurrencies(ctx context.Context) ([]string, error)
 	List(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error)
+	// Stream calls fn for every order matching filter, oldest first, without
+	// holding the whole result in memory. Items are loaded when includeItems
+	// is set. An error from fn stops the stream and is returned.
+	Stream(ctx context.Context, filter *models.OrderFilter, includeItems bool, fn func(*models.Order) error) error
 }
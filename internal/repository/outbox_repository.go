@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+)
+
+type OutboxRepository interface {
+	// ClaimDue returns up to limit unsent events that are due, oldest first,
+	// skipping events claimed concurrently. Claimed events are not due again
+	// for lease, so that concurrent dispatchers do not publish them too.
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	MarkSent(ctx context.Context, seq int64) error
+	// Release ends the lease of claimed events that were not published, so
+	// they are due again at once without counting as a failed attempt
+	Release(ctx context.Context, seqs []int64) error
+	// MarkFailed records a failed publish; the event is due again after
+	// retryAfter
+	MarkFailed(ctx context.Context, seq int64, publishErr string, retryAfter time.Duration) error
+	// DeleteSent removes events sent longer than olderThan ago and returns
+	// how many were removed
+	DeleteSent(ctx context.Context, olderThan time.Duration) (int64, error)
+	// ListAfter returns up to limit events recorded after seq, sent or not,
+	// lowest seq first
+	ListAfter(ctx context.Context, seq int64, limit int) ([]models.OutboxEvent, error)
+	// GetEvent returns the event at seq, or nil if there is none
+	GetEvent(ctx context.Context, seq int64) (*models.OutboxEvent, error)
+	// LatestSeq returns the highest seq recorded, or 0 if there are no events
+	LatestSeq(ctx context.Context) (int64, error)
+}
+
+// OutboxListener reports outbox events as they are committed, from any
+// process writing to the database
+type OutboxListener interface {
+	// Listen calls notify with the seq of each event committed until ctx is
+	// done or the listener fails. When events may have been missed, such as
+	// after a lost connection, notify is called with 0.
+	Listen(ctx context.Context, notify func(seq int64)) error
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+)
+
+type PostgresIdempotencyRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresIdempotencyRepository creates a new PostgresIdempotencyRepository
+func NewPostgresIdempotencyRepository(db *sql.DB) *PostgresIdempotencyRepository {
+	return &PostgresIdempotencyRepository{db: db}
+}
+
+// reserveAttempts is how many times Reserve tries again when the key it could
+// not take is swept before it is read
+const reserveAttempts = 3
+
+// Reserve inserts the key, taking over rows that have already expired but
+// have not been swept yet, and unfinished reservations whose lease has run
+// out
+func (r *PostgresIdempotencyRepository) Reserve(ctx context.Context, key, requestHash string, ttl, lease time.Duration) (*models.IdempotencyRecord, bool, error) {
+	for attempt := 1; ; attempt++ {
+		record, created, err := r.reserve(ctx, key, requestHash, ttl, lease)
+		if errors.Is(err, sql.ErrNoRows) && attempt < reserveAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+		return record, created, nil
+	}
+}
+
+// reserve makes one attempt at Reserve. It returns sql.ErrNoRows when the key
+// was held at the insert but gone by the time it was read.
+func (r *PostgresIdempotencyRepository) reserve(ctx context.Context, key, requestHash string, ttl, lease time.Duration) (*models.IdempotencyRecord, bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (key, request_hash, created_at, expires_at, locked_until)
+		VALUES ($1, $2, NOW(), NOW() + make_interval(secs => $3), NOW() + make_interval(secs => $4))
+		ON CONFLICT (key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash,
+			response_status = NULL,
+			response_body = NULL,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at,
+			locked_until = EXCLUDED.locked_until
+		WHERE idempotency_keys.expires_at < NOW()
+			OR (idempotency_keys.response_status IS NULL AND COALESCE(idempotency_keys.locked_until, idempotency_keys.created_at) < NOW())
+		RETURNING key, request_hash, response_status, response_body, created_at, expires_at, locked_until
+	`
+	record, err := scanIdempotencyRecord(r.db.QueryRowContext(ctx, query, key, requestHash, ttl.Seconds(), lease.Seconds()))
+	if err == nil {
+		return record, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	query = `
+		SELECT key, request_hash, response_status, response_body, created_at, expires_at, locked_until
+		FROM idempotency_keys
+		WHERE key = $1
+	`
+	record, err = scanIdempotencyRecord(r.db.QueryRowContext(ctx, query, key))
+	if err != nil {
+		return nil, false, err
+	}
+	return record, false, nil
+}
+
+// Complete stores the response produced for a reserved key, unless the
+// reservation has been taken over since
+func (r *PostgresIdempotencyRepository) Complete(ctx context.Context, key string, lockedUntil time.Time, status int, body []byte) error {
+	query := `
+		UPDATE idempotency_keys
+		SET response_status = $3, response_body = $4, locked_until = NULL
+		WHERE key = $1 AND locked_until = $2 AND response_status IS NULL
+	`
+	result, err := r.db.ExecContext(ctx, query, key, lockedUntil, status, body)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	if rows == 0 {
+		return ErrReservationLost
+	}
+	return nil
+}
+
+// Release drops a reservation whose request failed so it can be retried. A
+// reservation taken over since is left to its new holder.
+func (r *PostgresIdempotencyRepository) Release(ctx context.Context, key string, lockedUntil time.Time) error {
+	query := `DELETE FROM idempotency_keys WHERE key = $1 AND locked_until = $2 AND response_status IS NULL`
+	if _, err := r.db.ExecContext(ctx, query, key, lockedUntil); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes keys whose TTL has passed
+func (r *PostgresIdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func scanIdempotencyRecord(row rowScanner) (*models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	var status sql.NullInt64
+	var lockedUntil sql.NullTime
+	if err := row.Scan(
+		&record.Key,
+		&record.RequestHash,
+		&status,
+		&record.ResponseBody,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+		&lockedUntil,
+	); err != nil {
+		return nil, err
+	}
+	record.ResponseStatus = int(status.Int64)
+	record.LockedUntil = lockedUntil.Time
+	return &record, nil
+}
@@ -1,16 +1,32 @@
-
-
 package repository
 
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/lib/pq"
 	"github.com/sabina/orders-api/internal/models"
 )
 
+// orderColumns is the column list read by scanOrder
+const orderColumns = `id, customer_id, total_amount, currency, status, cancellation_reason, cancellation_note, cancelled_at, version, created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// streamBatchSize is how many rows Stream fetches from its cursor at a time
+const streamBatchSize = 500
+
 type PostgresOrderRepository struct {
 	db *sql.DB
 }
@@ -28,14 +44,75 @@ func (r *PostgresOrderRepository) Create(ctx context.Context, order *models.Orde
 	}
 	defer tx.Rollback()
 
+	if err := insertOrder(ctx, tx, order); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// CreateBatch inserts several orders in one transaction. When atomic is set
+// the first failure rolls every order back and is returned. Otherwise each
+// order is inserted under its own savepoint: a failure only undoes that order
+// and is reported at the order's index in the returned slice.
+func (r *PostgresOrderRepository) CreateBatch(ctx context.Context, orders []*models.Order, atomic bool) ([]error, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	errs := make([]error, len(orders))
+	for i, order := range orders {
+		if atomic {
+			if err := insertOrder(ctx, tx, order); err != nil {
+				return nil, fmt.Errorf("order %d of batch: %w", i, err)
+			}
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_order"); err != nil {
+			return nil, fmt.Errorf("failed to create savepoint: %w", err)
+		}
+		if err := insertOrder(ctx, tx, order); err != nil {
+			errs[i] = err
+			order.ID = 0
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_order"); err != nil {
+				return nil, fmt.Errorf("failed to roll back to savepoint: %w", err)
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_order"); err != nil {
+			return nil, fmt.Errorf("failed to release savepoint: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return errs, nil
+}
+
+// insertOrder inserts an order, its initial history entry, its items and its
+// order.created event within tx, filling in the generated ID, version and
+// timestamps
+func insertOrder(ctx context.Context, tx *sql.Tx, order *models.Order) error {
 	query := `
-		INSERT INTO orders (customer_id, total_amount, status, created_at, updated_at)
-		VALUES ($1, $2, $3, NOW(), NOW())
-		RETURNING id, created_at, updated_at
+		INSERT INTO orders (customer_id, total_amount, currency, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING id, version, created_at, updated_at
 	`
-	err = tx.QueryRowContext(ctx, query, order.CustomerID, order.TotalAmount, order.Status).Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt)
+	err := tx.QueryRowContext(ctx, query, order.CustomerID, order.TotalAmount, order.Currency, order.Status).Scan(&order.ID, &order.Version, &order.CreatedAt, &order.UpdatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to insert order: %w", err)
+		return fmt.Errorf("failed to insert order: %w", asConstraintError(err))
+	}
+
+	if err := insertStatusHistory(ctx, tx, order.ID, nil, order.Status, models.SystemActor, "order created"); err != nil {
+		return err
 	}
 
 	if len(order.Items) > 0 {
@@ -46,56 +123,308 @@ func (r *PostgresOrderRepository) Create(ctx context.Context, order *models.Orde
 		for _, item := range order.Items {
 			_, err := tx.ExecContext(ctx, itemQuery, order.ID, item.ProductID, item.Quantity, item.Price)
 			if err != nil {
-				return fmt.Errorf("failed to insert order item: %w", err)
+				return fmt.Errorf("failed to insert order item: %w", asConstraintError(err))
 			}
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	return insertOutboxEvent(ctx, tx, models.EventOrderCreated, order.ID, models.OrderEventData{Order: order})
+}
+
+// asConstraintError turns errors caused by the data written, rather than by
+// the database itself, into a *ConstraintError
+func asConstraintError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch {
+	case pqErr.Code == "22001":
+		return &ConstraintError{Reason: "a value is too long", Err: err}
+	case pqErr.Code == "22003":
+		return &ConstraintError{Reason: "a number is out of range", Err: err}
+	case pqErr.Code.Class() == "23" && pqErr.Constraint != "":
+		return &ConstraintError{Reason: fmt.Sprintf("violates %s", pqErr.Constraint), Err: err}
+	case pqErr.Code.Class() == "23":
+		return &ConstraintError{Reason: "violates a data constraint", Err: err}
 	}
+	return err
+}
 
-	return nil
+// GetByID loads a single order together with its line items
+func (r *PostgresOrderRepository) GetByID(ctx context.Context, id int64) (*models.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1`
+	var order models.Order
+	err := scanOrder(r.db.QueryRowContext(ctx, query, id), &order)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
-func (r *PostgresOrderRepository) List(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
-	var conditions []string
-	var args []interface{}
-	argIndex := 1
+	items, err := loadItems(ctx, r.db, []int64{id})
+	if err != nil {
+		return nil, err
+	}
+	order.Items = items[id]
+	for i := range order.Items {
+		order.Items[i].Currency = order.Currency
+	}
+
+	return &order, nil
+}
+
+// loadItems fetches the line items of all the given orders in one query,
+// grouped by order ID
+func loadItems(ctx context.Context, q queryer, orderIDs []int64) (map[int64][]models.OrderItem, error) {
+	query := `
+		SELECT id, order_id, product_id, quantity, price
+		FROM order_items
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, id
+	`
+	rows, err := q.QueryContext(ctx, query, pq.Array(orderIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+	defer rows.Close()
 
-	// Build WHERE clause
-	if filter != nil {
-		if filter.CustomerID != nil {
-			conditions = append(conditions, fmt.Sprintf("customer_id = $%d", argIndex))
-			args = append(args, *filter.CustomerID)
-			argIndex++
+	items := make(map[int64][]models.OrderItem, len(orderIDs))
+	for rows.Next() {
+		var item models.OrderItem
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.Price); err != nil {
+			return nil, fmt.Errorf("failed to scan order item: %w", err)
 		}
-		if filter.Status != nil {
-			conditions = append(conditions, fmt.Sprintf("status = $%d", argIndex))
-			args = append(args, *filter.Status)
-			argIndex++
+		items[item.OrderID] = append(items[item.OrderID], item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate order items: %w", err)
+	}
+	return items, nil
+}
+
+// countItems returns the number of line items of each given order that has any
+func countItems(ctx context.Context, q queryer, orderIDs []int64) (map[int64]int, error) {
+	query := `
+		SELECT order_id, COUNT(*)
+		FROM order_items
+		WHERE order_id = ANY($1)
+		GROUP BY order_id
+	`
+	rows, err := q.QueryContext(ctx, query, pq.Array(orderIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count order items: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int, len(orderIDs))
+	for rows.Next() {
+		var orderID int64
+		var count int
+		if err := rows.Scan(&orderID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan order item count: %w", err)
 		}
-		if filter.FromDate != nil {
-			conditions = append(conditions, fmt.Sprintf("created_at >= $%d", argIndex))
-			args = append(args, *filter.FromDate)
-			argIndex++
+		counts[orderID] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate order item counts: %w", err)
+	}
+	return counts, nil
+}
+
+// attachItems sets the item count of every listed order, and the items
+// themselves when includeItems is set, using a single batched query
+func attachItems(ctx context.Context, q queryer, orders []models.Order, includeItems bool) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+
+	if includeItems {
+		items, err := loadItems(ctx, q, ids)
+		if err != nil {
+			return err
+		}
+		for i := range orders {
+			orders[i].Items = items[orders[i].ID]
+			for j := range orders[i].Items {
+				orders[i].Items[j].Currency = orders[i].Currency
+			}
+			count := len(orders[i].Items)
+			orders[i].ItemCount = &count
 		}
-		if filter.ToDate != nil {
-			conditions = append(conditions, fmt.Sprintf("created_at <= $%d", argIndex))
-			args = append(args, *filter.ToDate)
-			argIndex++
+		return nil
+	}
+
+	counts, err := countItems(ctx, q, ids)
+	if err != nil {
+		return err
+	}
+	for i := range orders {
+		count := counts[orders[i].ID]
+		orders[i].ItemCount = &count
+	}
+	return nil
+}
+
+// UpdateStatus changes an order's status while holding a row lock on it
+func (r *PostgresOrderRepository) UpdateStatus(ctx context.Context, id int64, update *models.StatusUpdate, check func(current *models.Order) error) (*models.Order, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1 FOR UPDATE`
+	var order models.Order
+	err = scanOrder(tx.QueryRowContext(ctx, query, id), &order)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock order: %w", err)
+	}
+
+	if update.ExpectedVersion != nil && *update.ExpectedVersion != order.Version {
+		return nil, &VersionConflictError{OrderID: id, ExpectedVersion: *update.ExpectedVersion, CurrentVersion: order.Version}
+	}
+
+	if check != nil {
+		if err := check(&order); err != nil {
+			return nil, err
+		}
+	}
+
+	// Cancellation details are only written when moving to cancelled;
+	// cancelled is terminal so they are never overwritten afterwards
+	var cancellationReason, cancellationNote sql.NullString
+	if update.Status == string(models.StatusCancelled) {
+		cancellationReason = sql.NullString{String: update.CancellationReason, Valid: true}
+		cancellationNote = sql.NullString{String: update.CancellationNote, Valid: true}
+	}
+
+	updateQuery := `
+		UPDATE orders
+		SET status = $2,
+			updated_at = NOW(),
+			cancellation_reason = COALESCE($3, cancellation_reason),
+			cancellation_note = COALESCE($4, cancellation_note),
+			cancelled_at = CASE WHEN $3::VARCHAR IS NULL THEN cancelled_at ELSE NOW() END,
+			version = version + 1
+		WHERE id = $1 AND version = $5
+		RETURNING ` + orderColumns
+	fromStatus, lockedVersion := order.Status, order.Version
+	err = scanOrder(tx.QueryRowContext(ctx, updateQuery, id, update.Status, cancellationReason, cancellationNote, lockedVersion), &order)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &VersionConflictError{OrderID: id, ExpectedVersion: lockedVersion}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update order status: %w", err)
+	}
+	if err := insertStatusHistory(ctx, tx, id, &fromStatus, update.Status, update.Actor, update.Reason); err != nil {
+		return nil, err
+	}
+	// The event carries the items too, so that consumers can tell which
+	// products the order contains
+	eventOrder := order
+	items, err := loadItems(ctx, tx, []int64{id})
+	if err != nil {
+		return nil, err
+	}
+	eventOrder.Items = items[id]
+	for i := range eventOrder.Items {
+		eventOrder.Items[i].Currency = order.Currency
+	}
+	eventData := models.OrderEventData{Order: &eventOrder, PreviousStatus: fromStatus}
+	if err := insertOutboxEvent(ctx, tx, models.EventOrderStatusChanged, id, eventData); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &order, nil
+}
+
+// GetStatusHistory returns an order's status changes, oldest first
+func (r *PostgresOrderRepository) GetStatusHistory(ctx context.Context, orderID int64) ([]models.StatusHistoryEntry, error) {
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM orders WHERE id = $1)", orderID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check order: %w", err)
+	}
+	if !exists {
+		return nil, ErrOrderNotFound
+	}
+
+	query := `
+		SELECT id, order_id, from_status, to_status, actor, reason, changed_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY changed_at, id
+	`
+	rows, err := r.db.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []models.StatusHistoryEntry{}
+	for rows.Next() {
+		var entry models.StatusHistoryEntry
+		var fromStatus sql.NullString
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.OrderID,
+			&fromStatus,
+			&entry.ToStatus,
+			&entry.Actor,
+			&entry.Reason,
+			&entry.ChangedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan status history: %w", err)
 		}
-		if filter.MinAmount != nil {
-			conditions = append(conditions, fmt.Sprintf("total_amount >= $%d", argIndex))
-			args = append(args, *filter.MinAmount)
-			argIndex++
+		if fromStatus.Valid {
+			entry.FromStatus = &fromStatus.String
 		}
-		if filter.MaxAmount != nil {
-			conditions = append(conditions, fmt.Sprintf("total_amount <= $%d", argIndex))
-			args = append(args, *filter.MaxAmount)
-			argIndex++
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate status history: %w", err)
+	}
+
+	return history, nil
+}
+
+// ListCurrencies returns the distinct currencies orders have been placed in
+func (r *PostgresOrderRepository) ListCurrencies(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT DISTINCT currency FROM orders ORDER BY currency")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list currencies: %w", err)
+	}
+	defer rows.Close()
+
+	var currencies []string
+	for rows.Next() {
+		var currency string
+		if err := rows.Scan(&currency); err != nil {
+			return nil, fmt.Errorf("failed to scan currency: %w", err)
 		}
+		currencies = append(currencies, currency)
+	}
+	return currencies, rows.Err()
+}
+
+func (r *PostgresOrderRepository) List(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
+	conditions, args := buildFilterConditions(filter)
+	if pagination.Keyset {
+		return r.listKeyset(ctx, conditions, args, pagination)
 	}
+	argIndex := len(args) + 1
 
 	whereClause := ""
 	if len(conditions) > 0 {
@@ -105,43 +434,33 @@ func (r *PostgresOrderRepository) List(ctx context.Context, filter *models.Order
 	// Get total count
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM orders %s", whereClause)
 	var total int64
-	err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total)
-	if err != nil {
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
 		return nil, fmt.Errorf("failed to count orders: %w", err)
 	}
 
+	orderBy, err := buildOrderBy(pagination.Sort)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get paginated results
 	offset := (pagination.Page - 1) * pagination.Limit
 	query := fmt.Sprintf(`
-		SELECT id, customer_id, total_amount, status, created_at, updated_at
+		SELECT %s
 		FROM orders
 		%s
-		ORDER BY created_at DESC
+		ORDER BY %s
 		LIMIT $%d OFFSET $%d
-	`, whereClause, argIndex, argIndex+1)
+	`, orderColumns, whereClause, orderBy, argIndex, argIndex+1)
 
 	args = append(args, pagination.Limit, offset)
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	orders, err := queryOrders(ctx, r.db, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list orders: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
-
-	var orders []models.Order
-	for rows.Next() {
-		var order models.Order
-		if err := rows.Scan(
-			&order.ID,
-			&order.CustomerID,
-			&order.TotalAmount,
-			&order.Status,
-			&order.CreatedAt,
-			&order.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan order: %w", err)
-		}
-		orders = append(orders, order)
+	if err := attachItems(ctx, r.db, orders, pagination.IncludeItems); err != nil {
+		return nil, err
 	}
 
 	totalPages := int(total) / pagination.Limit
@@ -158,4 +477,293 @@ func (r *PostgresOrderRepository) List(ctx context.Context, filter *models.Order
 	}, nil
 }
 
+// listKeyset pages through orders by (created_at, id), newest first. It reads
+// one row beyond the limit to find out whether another page exists in the
+// direction of travel, and never counts the full result.
+func (r *PostgresOrderRepository) listKeyset(ctx context.Context, conditions []string, args []interface{}, pagination *models.Pagination) (*models.PaginatedOrders, error) {
+	cursor := pagination.Cursor
+	backward := cursor != nil && cursor.Before
+	argIndex := len(args) + 1
+
+	if cursor != nil {
+		op := "<"
+		if backward {
+			op = ">"
+		}
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) %s ($%d, $%d)", op, argIndex, argIndex+1))
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		argIndex += 2
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	direction := "DESC"
+	if backward {
+		direction = "ASC"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM orders
+		%s
+		ORDER BY created_at %s, id %s
+		LIMIT $%d
+	`, orderColumns, whereClause, direction, direction, argIndex)
+	args = append(args, pagination.Limit+1)
+
+	orders, err := queryOrders(ctx, r.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(orders) > pagination.Limit
+	if hasMore {
+		orders = orders[:pagination.Limit]
+	}
+	if backward {
+		for i, j := 0, len(orders)-1; i < j; i, j = i+1, j-1 {
+			orders[i], orders[j] = orders[j], orders[i]
+		}
+	}
+	if err := attachItems(ctx, r.db, orders, pagination.IncludeItems); err != nil {
+		return nil, err
+	}
+
+	result := &models.PaginatedOrders{
+		Orders: orders,
+		Limit:  pagination.Limit,
+		Keyset: true,
+	}
+	if len(orders) == 0 {
+		return result, nil
+	}
+
+	first, last := orders[0], orders[len(orders)-1]
+	// Walking backward we came from older pages, so a next page always
+	// exists; walking forward from a cursor a previous page always exists
+	if backward || hasMore {
+		result.NextCursor = models.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	if (backward && hasMore) || (!backward && cursor != nil) {
+		result.PrevCursor = models.Cursor{CreatedAt: first.CreatedAt, ID: first.ID, Before: true}.Encode()
+	}
+	return result, nil
+}
+
+// Stream reads the matching orders through a server-side cursor inside a
+// read-only transaction, fetching streamBatchSize rows at a time, so memory
+// use does not grow with the size of the result
+func (r *PostgresOrderRepository) Stream(ctx context.Context, filter *models.OrderFilter, includeItems bool, fn func(*models.Order) error) error {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
+	conditions, args := buildFilterConditions(filter)
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	declare := fmt.Sprintf(`
+		DECLARE order_stream NO SCROLL CURSOR FOR
+		SELECT %s
+		FROM orders
+		%s
+		ORDER BY created_at, id
+	`, orderColumns, whereClause)
+	if _, err := tx.ExecContext(ctx, declare, args...); err != nil {
+		return fmt.Errorf("failed to open order cursor: %w", err)
+	}
+
+	fetch := fmt.Sprintf("FETCH %d FROM order_stream", streamBatchSize)
+	for {
+		orders, err := queryOrders(ctx, tx, fetch)
+		if err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			break
+		}
+		if err := attachItems(ctx, tx, orders, includeItems); err != nil {
+			return err
+		}
+		for i := range orders {
+			if err := fn(&orders[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// queryOrders runs a query selecting orderColumns and scans every row
+func queryOrders(ctx context.Context, q queryer, query string, args ...interface{}) ([]models.Order, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		var order models.Order
+		if err := scanOrder(rows, &order); err != nil {
+			return nil, fmt.Errorf("failed to scan order: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate orders: %w", err)
+	}
+	return orders, nil
+}
+
+// sortColumns maps sort keys to columns; only keys listed here ever reach SQL
+var sortColumns = map[string]string{
+	"created_at":   "created_at",
+	"updated_at":   "updated_at",
+	"total_amount": "total_amount",
+	"status":       "status",
+	"customer_id":  "customer_id",
+}
+
+// buildOrderBy renders an ORDER BY list for sort, defaulting to newest first.
+// id is appended, in the direction of the last key, so the order is stable.
+func buildOrderBy(sort []models.SortField) (string, error) {
+	if len(sort) == 0 {
+		return "created_at DESC, id DESC", nil
+	}
+
+	terms := make([]string, 0, len(sort)+1)
+	direction := "ASC"
+	for _, field := range sort {
+		column, ok := sortColumns[field.Field]
+		if !ok {
+			return "", fmt.Errorf("unsupported sort field: %s", field.Field)
+		}
+		direction = "ASC"
+		if field.Desc {
+			direction = "DESC"
+		}
+		terms = append(terms, column+" "+direction)
+	}
+	terms = append(terms, "id "+direction)
+	return strings.Join(terms, ", "), nil
+}
+
+// buildFilterConditions turns filter into SQL conditions on the orders table
+// with positional arguments starting at $1
+func buildFilterConditions(filter *models.OrderFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	argIndex := 1
+
+	if filter == nil {
+		return conditions, args
+	}
+	if len(filter.IDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf("id = ANY($%d)", argIndex))
+		args = append(args, pq.Array(filter.IDs))
+		argIndex++
+	}
+	if len(filter.CustomerIDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf("customer_id = ANY($%d)", argIndex))
+		args = append(args, pq.Array(filter.CustomerIDs))
+		argIndex++
+	}
+	if len(filter.Statuses) > 0 {
+		conditions = append(conditions, fmt.Sprintf("status = ANY($%d)", argIndex))
+		args = append(args, pq.Array(filter.Statuses))
+		argIndex++
+	}
+	if len(filter.ProductIDs) > 0 {
+		// Semi-join so an order with several matching items is listed once;
+		// the lookup uses idx_order_items_product_id
+		conditions = append(conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM order_items oi WHERE oi.order_id = orders.id AND oi.product_id = ANY($%d))", argIndex))
+		args = append(args, pq.Array(filter.ProductIDs))
+		argIndex++
+	}
+	if filter.CancellationReason != nil {
+		conditions = append(conditions, fmt.Sprintf("cancellation_reason = $%d", argIndex))
+		args = append(args, *filter.CancellationReason)
+		argIndex++
+	}
+	if filter.Currency != nil {
+		conditions = append(conditions, fmt.Sprintf("currency = $%d", argIndex))
+		args = append(args, *filter.Currency)
+		argIndex++
+	}
+	if filter.FromDate != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", argIndex))
+		args = append(args, *filter.FromDate)
+		argIndex++
+	}
+	if filter.ToDate != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at <= $%d", argIndex))
+		args = append(args, *filter.ToDate)
+		argIndex++
+	}
+	if filter.UpdatedSince != nil {
+		conditions = append(conditions, fmt.Sprintf("updated_at >= $%d", argIndex))
+		args = append(args, *filter.UpdatedSince)
+		argIndex++
+	}
+	if filter.MinAmount != nil {
+		conditions = append(conditions, fmt.Sprintf("total_amount >= $%d", argIndex))
+		args = append(args, *filter.MinAmount)
+		argIndex++
+	}
+	if filter.MaxAmount != nil {
+		conditions = append(conditions, fmt.Sprintf("total_amount <= $%d", argIndex))
+		args = append(args, *filter.MaxAmount)
+		argIndex++
+	}
+	return conditions, args
+}
+
+// insertStatusHistory records a status change as part of an open transaction
+func insertStatusHistory(ctx context.Context, tx *sql.Tx, orderID int64, fromStatus *string, toStatus, actor, reason string) error {
+	query := `
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor, reason, changed_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+	`
+	if _, err := tx.ExecContext(ctx, query, orderID, fromStatus, toStatus, actor, reason); err != nil {
+		return fmt.Errorf("failed to insert status history: %w", err)
+	}
+	return nil
+}
+
+// scanOrder reads a row selected with orderColumns into order
+func scanOrder(row rowScanner, order *models.Order) error {
+	var cancellationReason sql.NullString
+	var cancelledAt sql.NullTime
+	if err := row.Scan(
+		&order.ID,
+		&order.CustomerID,
+		&order.TotalAmount,
+		&order.Currency,
+		&order.Status,
+		&cancellationReason,
+		&order.CancellationNote,
+		&cancelledAt,
+		&order.Version,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	); err != nil {
+		return err
+	}
+	order.CancellationReason = nil
+	if cancellationReason.Valid {
+		order.CancellationReason = &cancellationReason.String
+	}
+	order.CancelledAt = nil
+	if cancelledAt.Valid {
+		order.CancelledAt = &cancelledAt.Time
+	}
+	return nil
+}
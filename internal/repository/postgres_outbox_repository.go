@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sabina/orders-api/internal/models"
+)
+
+// outboxChannel is the NOTIFY channel carrying the seq of each new outbox
+// event
+const outboxChannel = "outbox_events"
+
+type PostgresOutboxRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresOutboxRepository creates a new PostgresOutboxRepository
+func NewPostgresOutboxRepository(db *sql.DB) *PostgresOutboxRepository {
+	return &PostgresOutboxRepository{db: db}
+}
+
+func (r *PostgresOutboxRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	query := `
+		WITH due AS (
+			SELECT id FROM outbox_events
+			WHERE sent_at IS NULL AND available_at <= NOW()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox_events o
+		SET available_at = NOW() + make_interval(secs => $2)
+		FROM due
+		WHERE o.id = due.id
+		RETURNING o.id, o.attempts, o.payload
+	`
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var e models.OutboxEvent
+		var payload []byte
+		if err := rows.Scan(&e.Seq, &e.Attempts, &payload); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		if err := json.Unmarshal(payload, &e.Event); err != nil {
+			return nil, fmt.Errorf("failed to decode outbox event %d: %w", e.Seq, err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+
+	// UPDATE ... RETURNING does not keep the order of the claim
+	sort.Slice(events, func(i, j int) bool { return events[i].Seq < events[j].Seq })
+	return events, nil
+}
+
+func (r *PostgresOutboxRepository) MarkSent(ctx context.Context, seq int64) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE outbox_events SET sent_at = NOW(), last_error = '' WHERE id = $1`, seq); err != nil {
+		return fmt.Errorf("failed to mark outbox event %d sent: %w", seq, err)
+	}
+	return nil
+}
+
+func (r *PostgresOutboxRepository) Release(ctx context.Context, seqs []int64) error {
+	query := `UPDATE outbox_events SET available_at = NOW() WHERE id = ANY($1) AND sent_at IS NULL`
+	if _, err := r.db.ExecContext(ctx, query, pq.Array(seqs)); err != nil {
+		return fmt.Errorf("failed to release outbox events: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresOutboxRepository) MarkFailed(ctx context.Context, seq int64, publishErr string, retryAfter time.Duration) error {
+	query := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = $2, available_at = NOW() + make_interval(secs => $3)
+		WHERE id = $1
+	`
+	if _, err := r.db.ExecContext(ctx, query, seq, publishErr, retryAfter.Seconds()); err != nil {
+		return fmt.Errorf("failed to record failure of outbox event %d: %w", seq, err)
+	}
+	return nil
+}
+
+func (r *PostgresOutboxRepository) DeleteSent(ctx context.Context, olderThan time.Duration) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM outbox_events WHERE sent_at < NOW() - make_interval(secs => $1)`, olderThan.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sent outbox events: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// insertOutboxEvent records an event about an order within the transaction
+// that changes the order, so that the event exists if and only if the change
+// is committed
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, eventType string, orderID int64, data interface{}) error {
+	event, err := models.NewEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	query := `
+		INSERT INTO outbox_events (event_id, event_type, order_id, payload, available_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING id
+	`
+	var seq int64
+	if err := tx.QueryRowContext(ctx, query, event.ID, event.Type, orderID, payload).Scan(&seq); err != nil {
+		return fmt.Errorf("failed to insert outbox event: %w", err)
+	}
+
+	// Postgres delivers the notification when, and only if, tx commits
+	if _, err := tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", outboxChannel, strconv.FormatInt(seq, 10)); err != nil {
+		return fmt.Errorf("failed to notify outbox event: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresOutboxRepository) ListAfter(ctx context.Context, seq int64, limit int) ([]models.OutboxEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, payload FROM outbox_events WHERE id > $1 ORDER BY id LIMIT $2`, seq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var e models.OutboxEvent
+		if err := scanOutboxEvent(rows, &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list outbox events: %w", err)
+	}
+	return events, nil
+}
+
+func (r *PostgresOutboxRepository) GetEvent(ctx context.Context, seq int64) (*models.OutboxEvent, error) {
+	var e models.OutboxEvent
+	err := scanOutboxEvent(r.db.QueryRowContext(ctx, `SELECT id, payload FROM outbox_events WHERE id = $1`, seq), &e)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *PostgresOutboxRepository) LatestSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM outbox_events`).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("failed to get latest outbox event: %w", err)
+	}
+	return seq, nil
+}
+
+func scanOutboxEvent(row rowScanner, e *models.OutboxEvent) error {
+	var payload []byte
+	if err := row.Scan(&e.Seq, &payload); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return fmt.Errorf("failed to scan outbox event: %w", err)
+	}
+	if err := json.Unmarshal(payload, &e.Event); err != nil {
+		return fmt.Errorf("failed to decode outbox event %d: %w", e.Seq, err)
+	}
+	return nil
+}
+
+// PostgresOutboxListener receives outbox notifications over a dedicated
+// connection with LISTEN
+type PostgresOutboxListener struct {
+	connStr string
+}
+
+// NewPostgresOutboxListener creates a listener connecting with connStr
+func NewPostgresOutboxListener(connStr string) *PostgresOutboxListener {
+	return &PostgresOutboxListener{connStr: connStr}
+}
+
+func (l *PostgresOutboxListener) Listen(ctx context.Context, notify func(seq int64)) error {
+	listener := pq.NewListener(l.connStr, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Outbox listener connection error: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(outboxChannel); err != nil {
+		return fmt.Errorf("failed to listen for outbox events: %w", err)
+	}
+
+	// An idle connection is pinged so that a silently dropped one is noticed
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n := <-listener.Notify:
+			// A nil notification follows a reconnect
+			if n == nil {
+				notify(0)
+				continue
+			}
+			seq, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				log.Printf("Ignoring malformed outbox notification %q", n.Extra)
+				continue
+			}
+			notify(seq)
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
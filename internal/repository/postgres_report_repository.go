@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+)
+
+type PostgresReportRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresReportRepository creates a new PostgresReportRepository
+func NewPostgresReportRepository(db *sql.DB) *PostgresReportRepository {
+	return &PostgresReportRepository{db: db}
+}
+
+// salesGroupColumns maps group_by values to columns; only keys listed here
+// ever reach SQL
+var salesGroupColumns = map[string]string{
+	"status":      "status",
+	"customer_id": "customer_id",
+}
+
+// SalesReport aggregates matching orders per date_trunc bucket. Buckets come
+// from generate_series and are left joined to the orders so that intervals
+// without orders are still returned.
+func (r *PostgresReportRepository) SalesReport(ctx context.Context, q *models.SalesReportQuery) ([]models.SalesBucket, error) {
+	groupColumn := "NULL::text"
+	if q.GroupBy != "" {
+		column, ok := salesGroupColumns[q.GroupBy]
+		if !ok {
+			return nil, fmt.Errorf("unsupported group_by field: %s", q.GroupBy)
+		}
+		groupColumn = column
+	}
+
+	conditions, args := reportConditions(q.Filter, q.IncludeCancelled)
+	argIndex := len(args) + 1
+	intervalArg, fromArg, toArg, endArg := argIndex, argIndex+1, argIndex+2, argIndex+3
+	conditions = append(conditions,
+		fmt.Sprintf("created_at >= $%d", fromArg),
+		fmt.Sprintf("created_at < $%d", endArg),
+	)
+	args = append(args, string(q.Interval), q.From, q.To, q.To.AddDate(0, 0, 1))
+
+	query := fmt.Sprintf(`
+		WITH buckets AS (
+			SELECT generate_series(
+				date_trunc($%[1]d::text, $%[2]d::timestamp),
+				date_trunc($%[1]d::text, $%[3]d::timestamp),
+				('1 ' || $%[1]d::text)::interval
+			) AS bucket_start
+		),
+		matched AS (
+			SELECT date_trunc($%[1]d::text, created_at) AS bucket_start,
+				%[4]s AS group_key,
+				total_amount,
+				(SELECT COALESCE(SUM(oi.quantity), 0) FROM order_items oi WHERE oi.order_id = orders.id) AS units
+			FROM orders
+			WHERE %[5]s
+		)
+		SELECT b.bucket_start, m.group_key, COUNT(m.bucket_start),
+			COALESCE(SUM(m.total_amount), 0), COALESCE(SUM(m.units), 0)
+		FROM buckets b
+		LEFT JOIN matched m ON m.bucket_start = b.bucket_start
+		GROUP BY b.bucket_start, m.group_key
+		ORDER BY b.bucket_start, m.group_key
+	`, intervalArg, fromArg, toArg, groupColumn, strings.Join(conditions, " AND "))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build sales report: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []models.SalesBucket{}
+	for rows.Next() {
+		var group models.SalesGroup
+		var groupKey sql.NullString
+		var start time.Time
+		if err := rows.Scan(&start, &groupKey, &group.OrderCount, &group.GrossRevenue, &group.ItemUnits); err != nil {
+			return nil, fmt.Errorf("failed to scan sales bucket: %w", err)
+		}
+
+		if len(buckets) == 0 || !buckets[len(buckets)-1].Start.Equal(start) {
+			buckets = append(buckets, models.SalesBucket{Start: start})
+		}
+		bucket := &buckets[len(buckets)-1]
+		bucket.OrderCount += group.OrderCount
+		bucket.GrossRevenue += group.GrossRevenue
+		bucket.ItemUnits += group.ItemUnits
+
+		if groupKey.Valid {
+			group.Key = groupKey.String
+			group.AverageOrderValue = averageOrderValue(group.GrossRevenue, group.OrderCount)
+			bucket.Groups = append(bucket.Groups, group)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sales buckets: %w", err)
+	}
+
+	for i := range buckets {
+		buckets[i].AverageOrderValue = averageOrderValue(buckets[i].GrossRevenue, buckets[i].OrderCount)
+	}
+	return buckets, nil
+}
+
+// reportConditions extends the list filter conditions for reports, which
+// leave out cancelled orders unless the filter selects statuses explicitly or
+// includeCancelled is set
+func reportConditions(filter *models.OrderFilter, includeCancelled bool) ([]string, []interface{}) {
+	conditions, args := buildFilterConditions(filter)
+	if !includeCancelled && (filter == nil || len(filter.Statuses) == 0) {
+		conditions = append(conditions, "status <> 'cancelled'")
+	}
+	return conditions, args
+}
+
+func averageOrderValue(revenue models.Money, orders int64) models.Money {
+	if orders == 0 {
+		return 0
+	}
+	return revenue.DivRound(orders)
+}
+
+// CustomerSummary reads the customer's orders per status, then the spend of
+// those not cancelled per currency. Both queries use idx_orders_customer_id.
+func (r *PostgresReportRepository) CustomerSummary(ctx context.Context, customerID string) (*models.CustomerSummary, error) {
+	summary := &models.CustomerSummary{
+		CustomerID:   customerID,
+		StatusCounts: map[models.OrderStatus]int64{},
+		Spend:        []models.CustomerSpend{},
+	}
+
+	statusQuery := `
+		SELECT status, COUNT(*), MIN(created_at), MAX(created_at)
+		FROM orders
+		WHERE customer_id = $1
+		GROUP BY status
+	`
+	rows, err := r.db.QueryContext(ctx, statusQuery, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize customer orders: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status models.OrderStatus
+		var count int64
+		var first, last time.Time
+		if err := rows.Scan(&status, &count, &first, &last); err != nil {
+			return nil, fmt.Errorf("failed to scan customer status count: %w", err)
+		}
+		summary.StatusCounts[status] = count
+		summary.TotalOrders += count
+		if summary.FirstOrderAt.IsZero() || first.Before(summary.FirstOrderAt) {
+			summary.FirstOrderAt = first
+		}
+		if last.After(summary.LastOrderAt) {
+			summary.LastOrderAt = last
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate customer status counts: %w", err)
+	}
+	if summary.TotalOrders == 0 {
+		return nil, ErrCustomerNotFound
+	}
+
+	spendQuery := `
+		SELECT currency, COUNT(*), SUM(total_amount)
+		FROM orders
+		WHERE customer_id = $1 AND status <> 'cancelled'
+		GROUP BY currency
+		ORDER BY currency
+	`
+	spendRows, err := r.db.QueryContext(ctx, spendQuery, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize customer spend: %w", err)
+	}
+	defer spendRows.Close()
+
+	for spendRows.Next() {
+		var spend models.CustomerSpend
+		if err := spendRows.Scan(&spend.Currency, &spend.OrderCount, &spend.LifetimeSpend); err != nil {
+			return nil, fmt.Errorf("failed to scan customer spend: %w", err)
+		}
+		summary.Spend = append(summary.Spend, spend)
+	}
+	if err := spendRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate customer spend: %w", err)
+	}
+	return summary, nil
+}
+
+// productSortColumns maps product report sort keys to result columns; only
+// keys listed here ever reach SQL
+var productSortColumns = map[string]string{
+	"units_sold":     "units_sold",
+	"revenue":        "revenue",
+	"order_count":    "order_count",
+	"customer_count": "customer_count",
+	"product_id":     "product_id",
+}
+
+// ProductReport aggregates the line items of matching orders per product.
+// The orders are filtered in a subquery so the filter conditions' unqualified
+// column names refer to orders only.
+func (r *PostgresReportRepository) ProductReport(ctx context.Context, q *models.ProductReportQuery) ([]models.ProductSales, error) {
+	orderBy := "revenue DESC"
+	if len(q.Sort) > 0 {
+		terms := make([]string, 0, len(q.Sort))
+		for _, field := range q.Sort {
+			column, ok := productSortColumns[field.Field]
+			if !ok {
+				return nil, fmt.Errorf("unsupported sort field: %s", field.Field)
+			}
+			direction := "ASC"
+			if field.Desc {
+				direction = "DESC"
+			}
+			terms = append(terms, column+" "+direction)
+		}
+		orderBy = strings.Join(terms, ", ")
+	}
+
+	conditions, args := reportConditions(q.Filter, q.IncludeCancelled)
+	argIndex := len(args) + 1
+	conditions = append(conditions,
+		fmt.Sprintf("created_at >= $%d", argIndex),
+		fmt.Sprintf("created_at < $%d", argIndex+1),
+	)
+	args = append(args, q.From, q.To.AddDate(0, 0, 1), q.Limit)
+
+	query := fmt.Sprintf(`
+		SELECT oi.product_id,
+			SUM(oi.quantity) AS units_sold,
+			SUM(oi.price * oi.quantity) AS revenue,
+			COUNT(DISTINCT oi.order_id) AS order_count,
+			COUNT(DISTINCT o.customer_id) AS customer_count
+		FROM order_items oi
+		JOIN (SELECT id, customer_id FROM orders WHERE %s) o ON o.id = oi.order_id
+		GROUP BY oi.product_id
+		ORDER BY %s, product_id
+		LIMIT $%d
+	`, strings.Join(conditions, " AND "), orderBy, argIndex+2)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build product report: %w", err)
+	}
+	defer rows.Close()
+
+	products := []models.ProductSales{}
+	for rows.Next() {
+		var product models.ProductSales
+		if err := rows.Scan(&product.ProductID, &product.UnitsSold, &product.Revenue, &product.OrderCount, &product.CustomerCount); err != nil {
+			return nil, fmt.Errorf("failed to scan product sales: %w", err)
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate product sales: %w", err)
+	}
+	return products, nil
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sabina/orders-api/internal/models"
+)
+
+const subscriptionColumns = `id, url, event_types, secret, active, created_at, updated_at`
+
+const deliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, last_status_code, last_error, created_at`
+
+type PostgresWebhookRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresWebhookRepository creates a new PostgresWebhookRepository
+func NewPostgresWebhookRepository(db *sql.DB) *PostgresWebhookRepository {
+	return &PostgresWebhookRepository{db: db}
+}
+
+func (r *PostgresWebhookRepository) CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	query := `
+		INSERT INTO webhook_subscriptions (url, event_types, secret, active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING ` + subscriptionColumns
+	err := scanSubscription(r.db.QueryRowContext(ctx, query, sub.URL, pq.Array(sub.EventTypes), sub.Secret, sub.Active), sub)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook subscription: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresWebhookRepository) GetSubscription(ctx context.Context, id int64) (*models.WebhookSubscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1`
+	var sub models.WebhookSubscription
+	err := scanSubscription(r.db.QueryRowContext(ctx, query, id), &sub)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+func (r *PostgresWebhookRepository) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []models.WebhookSubscription{}
+	for rows.Next() {
+		var sub models.WebhookSubscription
+		if err := scanSubscription(rows, &sub); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func (r *PostgresWebhookRepository) UpdateSubscription(ctx context.Context, sub *models.WebhookSubscription) error {
+	query := `
+		UPDATE webhook_subscriptions
+		SET url = $2, event_types = $3, secret = $4, active = $5, updated_at = NOW()
+		WHERE id = $1
+		RETURNING ` + subscriptionColumns
+	err := scanSubscription(r.db.QueryRowContext(ctx, query, sub.ID, sub.URL, pq.Array(sub.EventTypes), sub.Secret, sub.Active), sub)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+	return nil
+}
+
+// DeleteSubscription removes a subscription together with its deliveries
+func (r *PostgresWebhookRepository) DeleteSubscription(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+func (r *PostgresWebhookRepository) EnqueueDeliveries(ctx context.Context, event *models.Event) (int64, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event: %w", err)
+	}
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+		SELECT id, $1, $2, $3, 'pending', NOW(), NOW()
+		FROM webhook_subscriptions
+		WHERE active AND $2 = ANY(event_types)
+		ON CONFLICT (subscription_id, event_id) DO NOTHING
+	`
+	result, err := r.db.ExecContext(ctx, query, event.ID, event.Type, payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *PostgresWebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	query := `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM due, webhook_subscriptions s
+		WHERE d.id = due.id AND s.id = d.subscription_id
+		RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+			d.next_attempt_at, d.last_attempt_at, d.last_status_code, d.last_error, d.created_at, s.url, s.secret
+	`
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := scanDelivery(rows, &d, &d.URL, &d.Secret); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *PostgresWebhookRepository) RecordAttempt(ctx context.Context, id int64, attempt *models.DeliveryAttempt) error {
+	// Times are taken from the database clock that ClaimDueDeliveries compares
+	// them with. A delivery that is not retried keeps its last due time.
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, last_status_code = $3, last_error = $4,
+			last_attempt_at = NOW(),
+			next_attempt_at = COALESCE(NOW() + make_interval(secs => $5::double precision), next_attempt_at)
+		WHERE id = $1
+	`
+	var retryAfter *float64
+	if attempt.RetryAfter != nil {
+		secs := attempt.RetryAfter.Seconds()
+		retryAfter = &secs
+	}
+	_, err := r.db.ExecContext(ctx, query, id, attempt.Status, attempt.StatusCode, attempt.Error, retryAfter)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery attempt: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresWebhookRepository) ListDeliveries(ctx context.Context, subscriptionID int64, status string, limit int) ([]models.WebhookDelivery, error) {
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`
+	rows, err := r.db.QueryContext(ctx, query, subscriptionID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanSubscription(row rowScanner, sub *models.WebhookSubscription) error {
+	return row.Scan(&sub.ID, &sub.URL, pq.Array(&sub.EventTypes), &sub.Secret, &sub.Active, &sub.CreatedAt, &sub.UpdatedAt)
+}
+
+// scanDelivery reads the deliveryColumns, followed by any extra columns
+func scanDelivery(row rowScanner, d *models.WebhookDelivery, extra ...interface{}) error {
+	var payload []byte
+	var statusCode sql.NullInt64
+	dest := []interface{}{
+		&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastAttemptAt, &statusCode, &d.LastError, &d.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	d.Payload = payload
+	if d.Status != models.DeliveryPending {
+		d.NextAttemptAt = nil
+	}
+	if statusCode.Valid {
+		code := int(statusCode.Int64)
+		d.LastStatusCode = &code
+	}
+	return nil
+}
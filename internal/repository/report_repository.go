@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sabina/orders-api/internal/models"
+)
+
+// ErrCustomerNotFound is returned when no orders exist for a customer ID
+var ErrCustomerNotFound = errors.New("customer not found")
+
+type ReportRepository interface {
+	// SalesReport returns one bucket per interval between the query's From and
+	// To dates, including empty buckets
+	SalesReport(ctx context.Context, query *models.SalesReportQuery) ([]models.SalesBucket, error)
+	// CustomerSummary returns the customer's order counts per status and spend
+	// per currency, or ErrCustomerNotFound when the customer has no orders
+	CustomerSummary(ctx context.Context, customerID string) (*models.CustomerSummary, error)
+	// ProductReport returns per-product sales, ordered and limited as asked
+	ProductReport(ctx context.Context, query *models.ProductReportQuery) ([]models.ProductSales, error)
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+)
+
+// ErrSubscriptionNotFound is returned when no webhook subscription exists
+// with the requested ID
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, sub *models.WebhookSubscription) error
+	GetSubscription(ctx context.Context, id int64) (*models.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, sub *models.WebhookSubscription) error
+	DeleteSubscription(ctx context.Context, id int64) error
+
+	// EnqueueDeliveries queues event for every active subscription to its
+	// type and returns how many deliveries were queued. An event already
+	// queued for a subscription is not queued again.
+	EnqueueDeliveries(ctx context.Context, event *models.Event) (int64, error)
+	// ClaimDueDeliveries returns up to limit pending deliveries whose next
+	// attempt is due, with their subscription's URL and secret. Claimed
+	// deliveries are not due again for lease, so that concurrent dispatchers
+	// skip them while they are being sent.
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, id int64, attempt *models.DeliveryAttempt) error
+	// ListDeliveries returns a subscription's most recent deliveries, newest
+	// first, optionally only those with the given status
+	ListDeliveries(ctx context.Context, subscriptionID int64, status string, limit int) ([]models.WebhookDelivery, error)
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// ErrorKind classifies a domain error by what went wrong, independently of
+// how a transport reports it
+type ErrorKind string
+
+const (
+	// KindValidation means the input is malformed or missing required values
+	KindValidation ErrorKind = "validation"
+	// KindUnprocessable means the input is well-formed but inconsistent
+	KindUnprocessable ErrorKind = "unprocessable"
+	// KindNotFound means the target resource does not exist
+	KindNotFound ErrorKind = "not_found"
+	// KindConflict means the request conflicts with the resource's state
+	KindConflict ErrorKind = "conflict"
+	// KindPreconditionFailed means a client-supplied precondition no longer holds
+	KindPreconditionFailed ErrorKind = "precondition_failed"
+	// KindTooLarge means the request covers more items than allowed at once
+	KindTooLarge ErrorKind = "too_large"
+)
+
+// FieldError describes a problem with one input field
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Error is a domain error carrying a stable, machine-readable code. Errors
+// compare equal under errors.Is when their codes match, so the package's
+// sentinel errors match any error created with the same code.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// CodeValidationFailed is the code of errors that list invalid fields
+const CodeValidationFailed = "validation_failed"
+
+// NewValidationError reports a single invalid field
+func NewValidationError(field, code, message string) *Error {
+	return &Error{
+		Kind:    KindValidation,
+		Code:    CodeValidationFailed,
+		Message: message,
+		Fields:  []FieldError{{Field: field, Code: code, Message: message}},
+	}
+}
+
+// ErrOrderNotFound is returned when the requested order does not exist
+var ErrOrderNotFound = &Error{
+	Kind:    KindNotFound,
+	Code:    "order_not_found",
+	Message: repository.ErrOrderNotFound.Error(),
+	Err:     repository.ErrOrderNotFound,
+}
+
+// ErrCustomerNotFound is returned when no orders exist for a customer
+var ErrCustomerNotFound = &Error{
+	Kind:    KindNotFound,
+	Code:    "customer_not_found",
+	Message: repository.ErrCustomerNotFound.Error(),
+	Err:     repository.ErrCustomerNotFound,
+}
+
+// VersionConflictError is returned when an If-Match precondition no longer
+// holds because the order has been modified
+type VersionConflictError = repository.VersionConflictError
+
+// ErrVersionConflict matches errors caused by a VersionConflictError
+var ErrVersionConflict = &Error{
+	Kind:    KindPreconditionFailed,
+	Code:    "version_conflict",
+	Message: "order has been modified",
+}
+
+// ErrInvalidTransition matches errors caused by a TransitionError
+var ErrInvalidTransition = &Error{
+	Kind:    KindConflict,
+	Code:    "invalid_transition",
+	Message: "status transition not allowed",
+}
+
+// ErrInvalidStatus is returned when a status is not one of the known order statuses
+var ErrInvalidStatus = &Error{
+	Kind:    KindValidation,
+	Code:    "invalid_status",
+	Message: "invalid order status",
+}
+
+// ErrInvalidCancellationReason is returned when a cancellation reason code is
+// missing or unknown
+var ErrInvalidCancellationReason = &Error{
+	Kind:    KindValidation,
+	Code:    "invalid_cancellation_reason",
+	Message: "invalid cancellation reason",
+}
+
+// ErrCurrencyRequired is returned when an amount filter is used without a
+// currency while orders exist in more than one currency
+var ErrCurrencyRequired = &Error{
+	Kind:    KindValidation,
+	Code:    "currency_required",
+	Message: "currency is required when filtering by amount because orders exist in multiple currencies",
+	Fields:  []FieldError{{Field: "currency", Code: "required", Message: "is required when filtering by amount"}},
+}
+
+// ErrBatchTooLarge is returned when a bulk operation would affect more orders
+// than its limit
+var ErrBatchTooLarge = &Error{
+	Kind:    KindTooLarge,
+	Code:    "batch_too_large",
+	Message: "too many orders for one request",
+}
+
+// ErrConstraintViolation is returned when the database rejects an order's
+// data that validation let through
+var ErrConstraintViolation = &Error{
+	Kind:    KindUnprocessable,
+	Code:    "constraint_violation",
+	Message: "order was rejected by the database",
+}
+
+// ErrTotalMismatch matches errors caused by a TotalMismatchError
+var ErrTotalMismatch = &Error{
+	Kind:    KindUnprocessable,
+	Code:    "total_mismatch",
+	Message: "total_amount does not match the sum of items",
+}
+
+// TotalMismatchError is returned when the total_amount sent by a client does
+// not equal the sum of its line items
+type TotalMismatchError struct {
+	Declared models.Money
+	Computed models.Money
+}
+
+func (e *TotalMismatchError) Error() string {
+	return fmt.Sprintf("total_amount %s does not match the sum of items %s", e.Declared, e.Computed)
+}
+
+// Wrap returns a copy of e that describes and wraps the underlying err
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Message = err.Error()
+	wrapped.Err = err
+	return &wrapped
+}
+
+// withDetail returns a copy of sentinel with detail appended to its message
+func withDetail(sentinel *Error, detail string) *Error {
+	e := *sentinel
+	e.Message = fmt.Sprintf("%s: %s", sentinel.Message, detail)
+	return &e
+}
+
+// translateRepoError turns repository errors into domain errors
+func translateRepoError(err error) error {
+	var versionErr *VersionConflictError
+	var transitionErr *TransitionError
+	var domainErr *Error
+	var constraintErr *repository.ConstraintError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &domainErr):
+		return err
+	case errors.Is(err, repository.ErrOrderNotFound):
+		return ErrOrderNotFound
+	case errors.Is(err, repository.ErrCustomerNotFound):
+		return ErrCustomerNotFound
+	case errors.Is(err, repository.ErrSubscriptionNotFound):
+		return ErrSubscriptionNotFound
+	case errors.As(err, &versionErr):
+		return ErrVersionConflict.Wrap(err)
+	case errors.As(err, &transitionErr):
+		return ErrInvalidTransition.Wrap(err)
+	case errors.As(err, &constraintErr):
+		// Only the reason: the wrapped database message is not for clients
+		wrapped := withDetail(ErrConstraintViolation, constraintErr.Reason)
+		wrapped.Err = err
+		return wrapped
+	}
+	return err
+}
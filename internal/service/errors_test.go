@@ -0,0 +1,46 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+func TestTranslateRepoError(t *testing.T) {
+	err := translateRepoError(repository.ErrOrderNotFound)
+	if !errors.Is(err, ErrOrderNotFound) || !errors.Is(err, repository.ErrOrderNotFound) {
+		t.Errorf("expected not found to match both sentinels, got %v", err)
+	}
+
+	err = translateRepoError(&repository.VersionConflictError{OrderID: 1, ExpectedVersion: 1, CurrentVersion: 2})
+	var versionErr *VersionConflictError
+	if !errors.Is(err, ErrVersionConflict) || !errors.As(err, &versionErr) {
+		t.Errorf("expected a version conflict wrapping the repository error, got %v", err)
+	}
+
+	err = translateRepoError(&TransitionError{From: models.StatusDelivered, To: models.StatusPending})
+	var domainErr *Error
+	if !errors.As(err, &domainErr) || domainErr.Kind != KindConflict {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+
+	other := errors.New("connection refused")
+	if err := translateRepoError(other); err != other {
+		t.Errorf("expected unknown errors to pass through, got %v", err)
+	}
+}
+
+func TestError_IsMatchesCode(t *testing.T) {
+	err := withDetail(ErrInvalidStatus, "lost")
+	if !errors.Is(err, ErrInvalidStatus) {
+		t.Error("expected detailed error to match its sentinel")
+	}
+	if errors.Is(err, ErrInvalidCancellationReason) {
+		t.Error("expected errors with different codes not to match")
+	}
+	if err.Error() != "invalid order status: lost" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// ErrIdempotencyKeyReused is returned when a key is sent again with a
+// different request body
+var ErrIdempotencyKeyReused = &Error{
+	Kind:    KindUnprocessable,
+	Code:    "idempotency_key_reused",
+	Message: "Idempotency-Key has already been used with a different request",
+}
+
+// ErrIdempotencyRequestInProgress is returned when a retry arrives while the
+// original request with the same key is still being processed
+var ErrIdempotencyRequestInProgress = &Error{
+	Kind:    KindConflict,
+	Code:    "idempotency_request_in_progress",
+	Message: "a request with this Idempotency-Key is still being processed",
+}
+
+// IdempotencyServiceInterface defines the contract for idempotency service
+type IdempotencyServiceInterface interface {
+	// Begin reserves key for a request. It returns the stored record when the
+	// request is an identical retry whose response should be replayed, and
+	// otherwise the reservation the request now holds, which is passed on to
+	// Complete or Release.
+	Begin(ctx context.Context, key string, body []byte) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, reservation *models.IdempotencyRecord, status int, body []byte) error
+	Release(ctx context.Context, reservation *models.IdempotencyRecord) error
+}
+
+// completeAttempts is how many times storing a response is tried before
+// giving up
+const completeAttempts = 3
+
+type IdempotencyService struct {
+	repo  repository.IdempotencyRepository
+	ttl   time.Duration
+	lease time.Duration
+}
+
+// NewIdempotencyService creates a service that replays responses for ttl. A
+// request that neither completes nor releases its key within lease, because
+// its process died for instance, stops blocking retries of the key.
+func NewIdempotencyService(repo repository.IdempotencyRepository, ttl, lease time.Duration) *IdempotencyService {
+	return &IdempotencyService{repo: repo, ttl: ttl, lease: lease}
+}
+
+func (s *IdempotencyService) Begin(ctx context.Context, key string, body []byte) (*models.IdempotencyRecord, error) {
+	hash := hashRequest(body)
+	record, created, err := s.repo.Reserve(ctx, key, hash, s.ttl, s.lease)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		return record, nil
+	}
+	if record.RequestHash != hash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if !record.Completed() {
+		return nil, ErrIdempotencyRequestInProgress
+	}
+	return record, nil
+}
+
+// Complete stores the response for the reservation, retrying briefly since a
+// lost response lets a retry of the request run again once the lease is over.
+// A reservation taken over by another request is not retried.
+func (s *IdempotencyService) Complete(ctx context.Context, reservation *models.IdempotencyRecord, status int, body []byte) error {
+	var err error
+	for attempt := 1; attempt <= completeAttempts; attempt++ {
+		err = s.repo.Complete(ctx, reservation.Key, reservation.LockedUntil, status, body)
+		if err == nil || errors.Is(err, repository.ErrReservationLost) {
+			return err
+		}
+		if attempt < completeAttempts {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+			}
+		}
+	}
+	return err
+}
+
+func (s *IdempotencyService) Release(ctx context.Context, reservation *models.IdempotencyRecord) error {
+	return s.repo.Release(ctx, reservation.Key, reservation.LockedUntil)
+}
+
+// RunSweeper deletes expired keys every interval until ctx is cancelled
+func (s *IdempotencyService) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.repo.DeleteExpired(ctx)
+			if err != nil {
+				log.Printf("Failed to sweep idempotency keys: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("Swept %d expired idempotency keys", deleted)
+			}
+		}
+	}
+}
+
+func hashRequest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
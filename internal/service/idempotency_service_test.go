@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// stubIdempotencyRepository fails Complete a set number of times, with
+// failErr or a connection error
+type stubIdempotencyRepository struct {
+	repository.IdempotencyRepository
+	failures  int
+	failErr   error
+	completes int
+	lease     time.Duration
+	completed time.Time
+}
+
+func (r *stubIdempotencyRepository) Reserve(ctx context.Context, key, requestHash string, ttl, lease time.Duration) (*models.IdempotencyRecord, bool, error) {
+	r.lease = lease
+	return &models.IdempotencyRecord{Key: key, RequestHash: requestHash, LockedUntil: time.Unix(60, 0)}, true, nil
+}
+
+func (r *stubIdempotencyRepository) Complete(ctx context.Context, key string, lockedUntil time.Time, status int, body []byte) error {
+	r.completes++
+	r.completed = lockedUntil
+	if r.completes <= r.failures {
+		if r.failErr != nil {
+			return r.failErr
+		}
+		return errors.New("connection reset")
+	}
+	return nil
+}
+
+func TestIdempotencyService_BeginReservesWithLease(t *testing.T) {
+	repo := &stubIdempotencyRepository{}
+	s := NewIdempotencyService(repo, 24*time.Hour, time.Minute)
+	record, err := s.Begin(context.Background(), "key-1", []byte(`{}`))
+	if err != nil || record == nil || record.Completed() {
+		t.Fatalf("expected a fresh reservation, got %v, %v", record, err)
+	}
+	if repo.lease != time.Minute {
+		t.Errorf("expected a 1m lease, got %v", repo.lease)
+	}
+
+	if err := s.Complete(context.Background(), record, 201, []byte(`{}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !repo.completed.Equal(record.LockedUntil) {
+		t.Errorf("expected Complete to be guarded by the reservation's lease, got %v", repo.completed)
+	}
+}
+
+func TestIdempotencyService_CompleteRetries(t *testing.T) {
+	repo := &stubIdempotencyRepository{failures: 2}
+	s := NewIdempotencyService(repo, time.Hour, time.Minute)
+	reservation := &models.IdempotencyRecord{Key: "key-1"}
+	if err := s.Complete(context.Background(), reservation, 201, []byte(`{}`)); err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+
+	repo = &stubIdempotencyRepository{failures: completeAttempts}
+	s = NewIdempotencyService(repo, time.Hour, time.Minute)
+	if err := s.Complete(context.Background(), reservation, 201, []byte(`{}`)); err == nil {
+		t.Error("expected an error once every attempt failed")
+	}
+	if repo.completes != completeAttempts {
+		t.Errorf("expected %d attempts, got %d", completeAttempts, repo.completes)
+	}
+}
+
+func TestIdempotencyService_CompleteLostReservation(t *testing.T) {
+	repo := &stubIdempotencyRepository{failures: 1, failErr: repository.ErrReservationLost}
+	s := NewIdempotencyService(repo, time.Hour, time.Minute)
+	err := s.Complete(context.Background(), &models.IdempotencyRecord{Key: "key-1"}, 201, []byte(`{}`))
+	if !errors.Is(err, repository.ErrReservationLost) {
+		t.Errorf("expected ErrReservationLost, got %v", err)
+	}
+	if repo.completes != 1 {
+		t.Errorf("expected a lost reservation not to be retried, got %d attempts", repo.completes)
+	}
+}
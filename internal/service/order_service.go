@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/sabina/orders-api/internal/models"
 	"github.com/sabina/orders-api/internal/repository"
@@ -11,48 +13,416 @@ import (
 // OrderServiceInterface defines the contract for order service
 type OrderServiceInterface interface {
 	CreateOrder(ctx context.Context, order *models.Order) error
+	CreateOrders(ctx context.Context, orders []models.Order, mode models.BatchMode) ([]BatchOrderResult, error)
+	BulkTransitionOrders(ctx context.Context, ids []int64, filter *models.OrderFilter, update *models.StatusUpdate, limit int) ([]BulkStatusResult, error)
+	GetOrder(ctx context.Context, id int64) (*models.Order, error)
+	TransitionOrder(ctx context.Context, id int64, update *models.StatusUpdate) (*models.Order, error)
+	CancelOrder(ctx context.Context, id int64, req *models.CancelRequest) (*models.Order, error)
+	GetOrderHistory(ctx context.Context, id int64) ([]models.StatusHistoryEntry, error)
 	ListOrders(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error)
+	ExportOrders(ctx context.Context, filter *models.OrderFilter, includeItems bool, fn func(*models.Order) error) error
 }
 
 type OrderService struct {
-	repo repository.OrderRepository
+	repo                repository.OrderRepository
+	supportedCurrencies []string
+	defaultCurrency     string
 }
 
-func NewOrderService(repo repository.OrderRepository) *OrderService {
-	return &OrderService{repo: repo}
+func NewOrderService(repo repository.OrderRepository, supportedCurrencies []string, defaultCurrency string) *OrderService {
+	return &OrderService{
+		repo:                repo,
+		supportedCurrencies: supportedCurrencies,
+		defaultCurrency:     defaultCurrency,
+	}
 }
 
 func (s *OrderService) CreateOrder(ctx context.Context, order *models.Order) error {
 	if err := s.validateOrder(order); err != nil {
 		return err
 	}
-	return s.repo.Create(ctx, order)
+	return translateRepoError(s.repo.Create(ctx, order))
+}
+
+// BatchOrderResult is the outcome of one order of a batch: the created order,
+// or the error that kept it from being created
+type BatchOrderResult struct {
+	Index int
+	Order *models.Order
+	Err   error
+}
+
+// CreateOrders validates and creates a batch of orders. In atomic mode any
+// invalid order fails the whole batch with a validation error listing the
+// fields of every invalid order, prefixed with orders[i]. In partial mode the
+// valid orders are created and each result carries its order's outcome.
+func (s *OrderService) CreateOrders(ctx context.Context, orders []models.Order, mode models.BatchMode) ([]BatchOrderResult, error) {
+	if mode == "" {
+		mode = models.BatchAtomic
+	}
+	if !mode.IsValid() {
+		return nil, NewValidationError("mode", "unknown_value", fmt.Sprintf("unknown batch mode %q; allowed: atomic, partial", mode))
+	}
+	if len(orders) == 0 {
+		return nil, NewValidationError("orders", "required", "orders must contain at least one order")
+	}
+
+	results := make([]BatchOrderResult, len(orders))
+	var valid []*models.Order
+	var validIndexes []int
+	var invalid []FieldError
+	for i := range orders {
+		order := &orders[i]
+		results[i] = BatchOrderResult{Index: i}
+		if err := s.validateOrder(order); err != nil {
+			results[i].Err = err
+			invalid = append(invalid, batchFieldErrors(i, err)...)
+			continue
+		}
+		valid = append(valid, order)
+		validIndexes = append(validIndexes, i)
+	}
+
+	atomic := mode == models.BatchAtomic
+	if atomic && len(invalid) > 0 {
+		return nil, &Error{
+			Kind:    KindValidation,
+			Code:    CodeValidationFailed,
+			Message: fmt.Sprintf("%d of %d orders are invalid; none were created", len(orders)-len(valid), len(orders)),
+			Fields:  invalid,
+		}
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	errs, err := s.repo.CreateBatch(ctx, valid, atomic)
+	if err != nil {
+		return nil, translateRepoError(err)
+	}
+	for j, i := range validIndexes {
+		if j < len(errs) && errs[j] != nil {
+			results[i].Err = translateRepoError(errs[j])
+			continue
+		}
+		results[i].Order = valid[j]
+	}
+	return results, nil
+}
+
+// batchFieldErrors places the field errors of the order at index within the
+// batch. Errors without fields are reported against the order itself.
+func batchFieldErrors(index int, err error) []FieldError {
+	prefix := fmt.Sprintf("orders[%d]", index)
+	var domainErr *Error
+	if !errors.As(err, &domainErr) || len(domainErr.Fields) == 0 {
+		return []FieldError{{Field: prefix, Code: "invalid", Message: err.Error()}}
+	}
+	fields := make([]FieldError, len(domainErr.Fields))
+	for i, field := range domainErr.Fields {
+		field.Field = prefix + "." + field.Field
+		fields[i] = field
+	}
+	return fields
+}
+
+func (s *OrderService) GetOrder(ctx context.Context, id int64) (*models.Order, error) {
+	order, err := s.repo.GetByID(ctx, id)
+	return order, translateRepoError(err)
+}
+
+// TransitionOrder moves an order to a new status. The current status is read
+// under a row lock so concurrent transitions are checked one at a time.
+func (s *OrderService) TransitionOrder(ctx context.Context, id int64, update *models.StatusUpdate) (*models.Order, error) {
+	if err := prepareStatusUpdate(update); err != nil {
+		return nil, err
+	}
+
+	to := models.OrderStatus(update.Status)
+	order, err := s.repo.UpdateStatus(ctx, id, update, func(current *models.Order) error {
+		from := models.OrderStatus(current.Status)
+		if !CanTransition(from, to) {
+			return &TransitionError{From: from, To: to, Allowed: AllowedTransitions(from)}
+		}
+		return nil
+	})
+	return order, translateRepoError(err)
+}
+
+// prepareStatusUpdate validates the target status and cancellation reason and
+// fills in their defaults
+func prepareStatusUpdate(update *models.StatusUpdate) error {
+	to := models.OrderStatus(update.Status)
+	if !to.IsValid() {
+		return withDetail(ErrInvalidStatus, update.Status)
+	}
+	if update.Actor == "" {
+		update.Actor = models.SystemActor
+	}
+	if to == models.StatusCancelled {
+		if update.CancellationReason == "" {
+			update.CancellationReason = string(models.CancellationOther)
+		}
+		if !models.CancellationReason(update.CancellationReason).IsValid() {
+			return withDetail(ErrInvalidCancellationReason, update.CancellationReason)
+		}
+	}
+	return nil
 }
 
+// Outcomes of one order in a bulk status change
+const (
+	BulkOutcomeUpdated   = "updated"
+	BulkOutcomeUnchanged = "unchanged"
+	BulkOutcomeFailed    = "failed"
+)
+
+// BulkStatusResult is the outcome of one order of a bulk status change. Order
+// is set when it was updated, Err when it failed.
+type BulkStatusResult struct {
+	OrderID int64
+	Outcome string
+	Order   *models.Order
+	Err     error
+}
+
+// BulkTransitionOrders moves the orders with the given IDs, or when ids is
+// empty every order matching filter, to update.Status. Each order goes
+// through TransitionOrder on its own, so one order failing its transition
+// rules does not affect the others; orders already in the target status are
+// left unchanged. At most limit orders are changed per call.
+func (s *OrderService) BulkTransitionOrders(ctx context.Context, ids []int64, filter *models.OrderFilter, update *models.StatusUpdate, limit int) ([]BulkStatusResult, error) {
+	if err := prepareStatusUpdate(update); err != nil {
+		return nil, err
+	}
+	update.ExpectedVersion = nil
+
+	ids, err := s.bulkTargets(ctx, ids, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BulkStatusResult, len(ids))
+	for i, id := range ids {
+		orderUpdate := *update
+		order, err := s.TransitionOrder(ctx, id, &orderUpdate)
+		var transitionErr *TransitionError
+		switch {
+		case err == nil:
+			results[i] = BulkStatusResult{OrderID: id, Outcome: BulkOutcomeUpdated, Order: order}
+		case errors.As(err, &transitionErr) && transitionErr.From == transitionErr.To:
+			results[i] = BulkStatusResult{OrderID: id, Outcome: BulkOutcomeUnchanged}
+		default:
+			results[i] = BulkStatusResult{OrderID: id, Outcome: BulkOutcomeFailed, Err: err}
+		}
+	}
+	return results, nil
+}
+
+// bulkTargets resolves the orders a bulk change applies to: the given IDs,
+// deduplicated, or the IDs of the orders matching filter. Exactly one of the
+// two must be given, so that a bulk change can never match every order by
+// accident.
+func (s *OrderService) bulkTargets(ctx context.Context, ids []int64, filter *models.OrderFilter, limit int) ([]int64, error) {
+	hasFilter := filter != nil && !filter.IsEmpty()
+	switch {
+	case len(ids) > 0 && hasFilter:
+		return nil, NewValidationError("ids", "conflicting_parameter", "ids cannot be combined with filter parameters")
+	case len(ids) == 0 && !hasFilter:
+		return nil, NewValidationError("ids", "required", "ids or at least one filter parameter is required")
+	}
+
+	tooLarge := withDetail(ErrBatchTooLarge, fmt.Sprintf("at most %d orders can be changed at once", limit))
+	if len(ids) > 0 {
+		var unique []int64
+		seen := make(map[int64]bool, len(ids))
+		for _, id := range ids {
+			if id < 1 {
+				return nil, NewValidationError("ids", "invalid_format", fmt.Sprintf("%d is not a valid order ID", id))
+			}
+			if !seen[id] {
+				seen[id] = true
+				unique = append(unique, id)
+			}
+		}
+		if len(unique) > limit {
+			return nil, tooLarge
+		}
+		return unique, nil
+	}
+
+	if err := s.checkAmountFilterCurrency(ctx, filter); err != nil {
+		return nil, err
+	}
+	var matched []int64
+	err := s.repo.Stream(ctx, filter, false, func(order *models.Order) error {
+		if len(matched) == limit {
+			return tooLarge
+		}
+		matched = append(matched, order.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matched, nil
+}
+
+// CancelOrder cancels a pending or processing order, recording why
+func (s *OrderService) CancelOrder(ctx context.Context, id int64, req *models.CancelRequest) (*models.Order, error) {
+	if req.ReasonCode == "" {
+		return nil, withDetail(ErrInvalidCancellationReason, "reason_code is required")
+	}
+
+	reason := req.ReasonCode
+	if req.Note != "" {
+		reason += ": " + req.Note
+	}
+	return s.TransitionOrder(ctx, id, &models.StatusUpdate{
+		Status:             string(models.StatusCancelled),
+		Actor:              req.Actor,
+		Reason:             reason,
+		CancellationReason: req.ReasonCode,
+		CancellationNote:   req.Note,
+		ExpectedVersion:    req.ExpectedVersion,
+	})
+}
+
+// GetOrderHistory returns the status timeline of an order, oldest first
+func (s *OrderService) GetOrderHistory(ctx context.Context, id int64) ([]models.StatusHistoryEntry, error) {
+	history, err := s.repo.GetStatusHistory(ctx, id)
+	return history, translateRepoError(err)
+}
 
 func (s *OrderService) ListOrders(ctx context.Context, filter *models.OrderFilter, pagination *models.Pagination) (*models.PaginatedOrders, error) {
-       // Validate pagination
-       if pagination.Page < 1 {
-	       pagination.Page = 1
-       }
-       if pagination.Limit < 1 {
-	       pagination.Limit = 10
-       }
-       return s.repo.List(ctx, filter, pagination)
+	// Validate pagination
+	if pagination.Page < 1 {
+		pagination.Page = 1
+	}
+	if pagination.Limit < 1 {
+		pagination.Limit = 10
+	}
+	if err := s.checkAmountFilterCurrency(ctx, filter); err != nil {
+		return nil, err
+	}
+	return s.repo.List(ctx, filter, pagination)
+}
+
+// ExportOrders streams every order matching filter to fn, oldest first, with
+// no page size limit
+func (s *OrderService) ExportOrders(ctx context.Context, filter *models.OrderFilter, includeItems bool, fn func(*models.Order) error) error {
+	if err := s.checkAmountFilterCurrency(ctx, filter); err != nil {
+		return err
+	}
+	return s.repo.Stream(ctx, filter, includeItems, fn)
 }
 
 func (s *OrderService) validateOrder(order *models.Order) error {
-       if order.CustomerID == "" {
-	       return fmt.Errorf("customer_id is required")
-       }
-       if order.TotalAmount < 0 {
-	       return fmt.Errorf("total_amount must be non-negative")
-       }
-       if order.Status == "" {
-	       order.Status = string(models.StatusPending)
-       }
-       if !models.OrderStatus(order.Status).IsValid() {
-	       return fmt.Errorf("invalid order status: %s", order.Status)
-       }
-       return nil
+	if order.CustomerID == "" {
+		return NewValidationError("customer_id", "required", "customer_id is required")
+	}
+	if order.TotalAmount < 0 {
+		return NewValidationError("total_amount", "negative", "total_amount must be non-negative")
+	}
+	order.Currency = strings.ToUpper(strings.TrimSpace(order.Currency))
+	if order.Currency == "" {
+		order.Currency = s.defaultCurrency
+	}
+	if !s.isSupportedCurrency(order.Currency) {
+		return NewValidationError("currency", "unsupported_currency", fmt.Sprintf("unsupported currency: %s", order.Currency))
+	}
+	if err := validateItems(order.Items, order.Currency); err != nil {
+		return err
+	}
+	if len(order.Items) > 0 {
+		computed := itemsTotal(order.Items)
+		if order.TotalAmount == 0 {
+			order.TotalAmount = computed
+		} else if order.TotalAmount != computed {
+			mismatch := ErrTotalMismatch.Wrap(&TotalMismatchError{Declared: order.TotalAmount, Computed: computed})
+			mismatch.Fields = []FieldError{{Field: "total_amount", Code: "total_mismatch", Message: mismatch.Message}}
+			return mismatch
+		}
+	}
+	if order.Status == "" {
+		order.Status = string(models.StatusPending)
+	}
+	if !models.OrderStatus(order.Status).IsValid() {
+		return NewValidationError("status", "invalid_status", fmt.Sprintf("invalid order status: %s", order.Status))
+	}
+	// Every later status is reached through the transition rules, which also
+	// record cancellation details; historical orders are loaded with import
+	if order.Status != string(models.StatusPending) {
+		return NewValidationError("status", "not_initial_status", fmt.Sprintf("orders are created as pending, not %s; change the status with a transition", order.Status))
+	}
+	return nil
+}
+
+// validateItems checks each line item and makes sure none of them is priced in
+// a currency other than the order's; items without a currency inherit it
+func validateItems(items []models.OrderItem, currency string) error {
+	for i := range items {
+		item := &items[i]
+		field := fmt.Sprintf("items[%d].", i)
+		if item.ProductID == "" {
+			return NewValidationError(field+"product_id", "required", field+"product_id is required")
+		}
+		if item.Quantity <= 0 {
+			return NewValidationError(field+"quantity", "not_positive", field+"quantity must be greater than 0")
+		}
+		if item.Price < 0 {
+			return NewValidationError(field+"price", "negative", field+"price must be non-negative")
+		}
+		item.Currency = strings.ToUpper(strings.TrimSpace(item.Currency))
+		if item.Currency == "" {
+			item.Currency = currency
+		} else if item.Currency != currency {
+			return NewValidationError(field+"currency", "currency_mismatch", fmt.Sprintf("%scurrency %s does not match order currency %s", field, item.Currency, currency))
+		}
+	}
+	return nil
+}
+
+func (s *OrderService) isSupportedCurrency(currency string) bool {
+	for _, supported := range s.supportedCurrencies {
+		if supported == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAmountFilterCurrency rejects amount filters that would compare totals
+// across currencies. When every order shares one currency the filter is
+// unambiguous and no currency is needed.
+func (s *OrderService) checkAmountFilterCurrency(ctx context.Context, filter *models.OrderFilter) error {
+	if filter == nil {
+		return nil
+	}
+	if filter.Currency != nil {
+		currency := strings.ToUpper(*filter.Currency)
+		filter.Currency = &currency
+		return nil
+	}
+	if filter.MinAmount == nil && filter.MaxAmount == nil {
+		return nil
+	}
+
+	currencies, err := s.repo.ListCurrencies(ctx)
+	if err != nil {
+		return err
+	}
+	if len(currencies) > 1 {
+		return ErrCurrencyRequired
+	}
+	return nil
+}
+
+// itemsTotal sums quantity * price over the items
+func itemsTotal(items []models.OrderItem) models.Money {
+	var total models.Money
+	for _, item := range items {
+		total += item.Price.Mul(item.Quantity)
+	}
+	return total
 }
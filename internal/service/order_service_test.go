@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+func TestValidateOrder_FillsTotalFromItems(t *testing.T) {
+	s := NewOrderService(nil, []string{"USD", "EUR"}, "USD")
+	order := &models.Order{
+		CustomerID: "cust-1",
+		Items: []models.OrderItem{
+			{ProductID: "prod-1", Quantity: 3, Price: 10},
+			{ProductID: "prod-2", Quantity: 1, Price: 20},
+		},
+	}
+	if err := s.validateOrder(order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order.TotalAmount != 50 {
+		t.Errorf("expected total 0.50, got %s", order.TotalAmount)
+	}
+}
+
+func TestValidateOrder_TotalMismatch(t *testing.T) {
+	s := NewOrderService(nil, []string{"USD", "EUR"}, "USD")
+	order := &models.Order{
+		CustomerID:  "cust-1",
+		TotalAmount: 100,
+		Items:       []models.OrderItem{{ProductID: "prod-1", Quantity: 5, Price: 10000}},
+	}
+	var mismatchErr *TotalMismatchError
+	if err := s.validateOrder(order); !errors.As(err, &mismatchErr) {
+		t.Fatalf("expected TotalMismatchError, got %v", err)
+	}
+	if mismatchErr.Declared != 100 || mismatchErr.Computed != 50000 {
+		t.Errorf("expected declared 1.00 and computed 500.00, got %s and %s", mismatchErr.Declared, mismatchErr.Computed)
+	}
+}
+
+func TestValidateOrder_InvalidItems(t *testing.T) {
+	tests := []struct {
+		name string
+		item models.OrderItem
+	}{
+		{"missing product", models.OrderItem{Quantity: 1, Price: 1}},
+		{"zero quantity", models.OrderItem{ProductID: "prod-1", Price: 1}},
+		{"negative price", models.OrderItem{ProductID: "prod-1", Quantity: 1, Price: -1}},
+	}
+	s := NewOrderService(nil, []string{"USD", "EUR"}, "USD")
+	for _, tt := range tests {
+		order := &models.Order{CustomerID: "cust-1", Items: []models.OrderItem{tt.item}}
+		if err := s.validateOrder(order); err == nil {
+			t.Errorf("%s: expected validation error", tt.name)
+		}
+	}
+}
+
+func TestValidateOrder_Currency(t *testing.T) {
+	s := NewOrderService(nil, []string{"USD", "EUR"}, "USD")
+
+	order := &models.Order{CustomerID: "cust-1", Items: []models.OrderItem{{ProductID: "prod-1", Quantity: 1, Price: 100}}}
+	if err := s.validateOrder(order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order.Currency != "USD" || order.Items[0].Currency != "USD" {
+		t.Errorf("expected default currency USD on order and items, got %q and %q", order.Currency, order.Items[0].Currency)
+	}
+
+	order = &models.Order{CustomerID: "cust-1", Currency: "jpy"}
+	if err := s.validateOrder(order); err == nil {
+		t.Error("expected unsupported currency to be rejected")
+	}
+
+	order = &models.Order{
+		CustomerID: "cust-1",
+		Currency:   "eur",
+		Items: []models.OrderItem{
+			{ProductID: "prod-1", Quantity: 1, Price: 100, Currency: "EUR"},
+			{ProductID: "prod-2", Quantity: 1, Price: 100, Currency: "USD"},
+		},
+	}
+	if err := s.validateOrder(order); err == nil {
+		t.Error("expected mixed item currencies to be rejected")
+	}
+}
+
+func TestValidateOrder_Status(t *testing.T) {
+	s := NewOrderService(nil, []string{"USD"}, "USD")
+
+	order := &models.Order{CustomerID: "cust-1"}
+	if err := s.validateOrder(order); err != nil || order.Status != "pending" {
+		t.Fatalf("expected a missing status to default to pending, got %q (%v)", order.Status, err)
+	}
+
+	for _, status := range []string{"processing", "shipped", "delivered", "cancelled", "lost"} {
+		var domainErr *Error
+		err := s.validateOrder(&models.Order{CustomerID: "cust-1", Status: status})
+		if !errors.As(err, &domainErr) || domainErr.Kind != KindValidation || domainErr.Fields[0].Field != "status" {
+			t.Errorf("%s: expected a status validation error, got %v", status, err)
+		}
+	}
+}
+
+// stubBatchRepository records the orders passed to CreateBatch and gives
+// created orders IDs, failing those listed in failures; every other method
+// panics through the nil embedded interface
+type stubBatchRepository struct {
+	repository.OrderRepository
+	created  [][]*models.Order
+	failures map[int]error
+}
+
+func (r *stubBatchRepository) CreateBatch(ctx context.Context, orders []*models.Order, atomic bool) ([]error, error) {
+	r.created = append(r.created, orders)
+	errs := make([]error, len(orders))
+	for i, order := range orders {
+		if err, ok := r.failures[i]; ok {
+			errs[i] = err
+			continue
+		}
+		order.ID = int64(i + 1)
+	}
+	return errs, nil
+}
+
+func TestCreateOrders_AtomicRejectsWholeBatch(t *testing.T) {
+	repo := &stubBatchRepository{}
+	s := NewOrderService(repo, []string{"USD"}, "USD")
+	orders := []models.Order{{CustomerID: "cust-1"}, {}, {CustomerID: "cust-3", Currency: "JPY"}}
+
+	_, err := s.CreateOrders(context.Background(), orders, models.BatchAtomic)
+	var domainErr *Error
+	if !errors.As(err, &domainErr) || domainErr.Kind != KindValidation {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if len(domainErr.Fields) != 2 || domainErr.Fields[0].Field != "orders[1].customer_id" || domainErr.Fields[1].Field != "orders[2].currency" {
+		t.Errorf("expected the fields of both invalid orders, got %+v", domainErr.Fields)
+	}
+	if len(repo.created) != 0 {
+		t.Error("expected nothing to be inserted")
+	}
+}
+
+func TestCreateOrders_PartialCreatesValidOrders(t *testing.T) {
+	repo := &stubBatchRepository{}
+	s := NewOrderService(repo, []string{"USD"}, "USD")
+	orders := []models.Order{{CustomerID: "cust-1"}, {}, {CustomerID: "cust-3"}}
+
+	results, err := s.CreateOrders(context.Background(), orders, models.BatchPartial)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.created) != 1 || len(repo.created[0]) != 2 {
+		t.Fatalf("expected the 2 valid orders to be inserted in one batch, got %v", repo.created)
+	}
+	if results[0].Order == nil || results[2].Order == nil || results[2].Order.CustomerID != "cust-3" {
+		t.Errorf("expected orders 0 and 2 to be created, got %+v", results)
+	}
+	if results[1].Err == nil || results[1].Order != nil {
+		t.Errorf("expected order 1 to fail validation, got %+v", results[1])
+	}
+}
+
+func TestCreateOrders_PartialHidesDatabaseErrors(t *testing.T) {
+	dbErr := fmt.Errorf("failed to insert order: %w", &repository.ConstraintError{
+		Reason: "a value is too long",
+		Err:    errors.New(`pq: value too long for type character varying(255)`),
+	})
+	repo := &stubBatchRepository{failures: map[int]error{1: dbErr}}
+	s := NewOrderService(repo, []string{"USD"}, "USD")
+
+	results, err := s.CreateOrders(context.Background(), []models.Order{{CustomerID: "cust-1"}, {CustomerID: "cust-2"}}, models.BatchPartial)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var domainErr *Error
+	if !errors.As(results[1].Err, &domainErr) || domainErr.Code != "constraint_violation" {
+		t.Fatalf("expected a constraint_violation error, got %v", results[1].Err)
+	}
+	if strings.Contains(domainErr.Message, "pq:") || !strings.Contains(domainErr.Message, "a value is too long") {
+		t.Errorf("expected only the reason in the message, got %q", domainErr.Message)
+	}
+}
+
+func TestCreateOrders_Validation(t *testing.T) {
+	s := NewOrderService(&stubBatchRepository{}, []string{"USD"}, "USD")
+	if _, err := s.CreateOrders(context.Background(), nil, models.BatchAtomic); err == nil {
+		t.Error("expected an empty batch to be rejected")
+	}
+	if _, err := s.CreateOrders(context.Background(), []models.Order{{CustomerID: "cust-1"}}, "best_effort"); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}
+
+// stubBulkRepository holds orders by ID and supports the methods used by bulk
+// status changes
+type stubBulkRepository struct {
+	repository.OrderRepository
+	orders map[int64]*models.Order
+}
+
+func (r *stubBulkRepository) Stream(ctx context.Context, filter *models.OrderFilter, includeItems bool, fn func(*models.Order) error) error {
+	for id := int64(1); id <= int64(len(r.orders)); id++ {
+		if order := r.orders[id]; containsString(filter.Statuses, order.Status) {
+			if err := fn(order); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *stubBulkRepository) UpdateStatus(ctx context.Context, id int64, update *models.StatusUpdate, check func(current *models.Order) error) (*models.Order, error) {
+	order, ok := r.orders[id]
+	if !ok {
+		return nil, repository.ErrOrderNotFound
+	}
+	if err := check(order); err != nil {
+		return nil, err
+	}
+	order.Status = update.Status
+	order.Version++
+	return order, nil
+}
+
+func newStubBulkRepository(statuses ...models.OrderStatus) *stubBulkRepository {
+	repo := &stubBulkRepository{orders: map[int64]*models.Order{}}
+	for i, status := range statuses {
+		repo.orders[int64(i+1)] = &models.Order{ID: int64(i + 1), Status: string(status), Version: 1}
+	}
+	return repo
+}
+
+func TestBulkTransitionOrders_Outcomes(t *testing.T) {
+	repo := newStubBulkRepository(models.StatusProcessing, models.StatusShipped, models.StatusPending)
+	s := NewOrderService(repo, []string{"USD"}, "USD")
+
+	update := &models.StatusUpdate{Status: string(models.StatusShipped)}
+	results, err := s.BulkTransitionOrders(context.Background(), []int64{1, 2, 3, 4, 1}, nil, update, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{BulkOutcomeUpdated, BulkOutcomeUnchanged, BulkOutcomeFailed, BulkOutcomeFailed}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d deduplicated results, got %d", len(want), len(results))
+	}
+	for i, result := range results {
+		if result.Outcome != want[i] {
+			t.Errorf("order %d: expected %s, got %s (%v)", result.OrderID, want[i], result.Outcome, result.Err)
+		}
+	}
+	if !errors.Is(results[2].Err, ErrInvalidTransition) || !errors.Is(results[3].Err, ErrOrderNotFound) {
+		t.Errorf("expected invalid transition and not found errors, got %v and %v", results[2].Err, results[3].Err)
+	}
+}
+
+func TestBulkTransitionOrders_Filter(t *testing.T) {
+	repo := newStubBulkRepository(models.StatusProcessing, models.StatusPending, models.StatusProcessing)
+	s := NewOrderService(repo, []string{"USD"}, "USD")
+
+	filter := &models.OrderFilter{Statuses: []string{string(models.StatusProcessing)}}
+	results, err := s.BulkTransitionOrders(context.Background(), nil, filter, &models.StatusUpdate{Status: "shipped"}, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].OrderID != 1 || results[1].OrderID != 3 {
+		t.Fatalf("expected orders 1 and 3, got %+v", results)
+	}
+
+	s = NewOrderService(newStubBulkRepository(models.StatusProcessing, models.StatusProcessing), []string{"USD"}, "USD")
+	_, err = s.BulkTransitionOrders(context.Background(), nil, filter, &models.StatusUpdate{Status: "shipped"}, 1)
+	if !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("expected ErrBatchTooLarge over the limit, got %v", err)
+	}
+}
+
+func TestBulkTransitionOrders_RequiresTargets(t *testing.T) {
+	s := NewOrderService(newStubBulkRepository(), []string{"USD"}, "USD")
+	update := &models.StatusUpdate{Status: "shipped"}
+	if _, err := s.BulkTransitionOrders(context.Background(), nil, &models.OrderFilter{}, update, 10); err == nil {
+		t.Error("expected a change without ids or filter to be rejected")
+	}
+	filter := &models.OrderFilter{Statuses: []string{"pending"}}
+	if _, err := s.BulkTransitionOrders(context.Background(), []int64{1}, filter, update, 10); err == nil {
+		t.Error("expected ids combined with a filter to be rejected")
+	}
+	if _, err := s.BulkTransitionOrders(context.Background(), []int64{1}, nil, &models.StatusUpdate{Status: "lost"}, 10); !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("expected ErrInvalidStatus, got %v", err)
+	}
+}
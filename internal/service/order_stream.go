@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// orderStreamBuffer is how many changes a subscriber may fall behind before
+// its stream is ended
+const orderStreamBuffer = 256
+
+// orderStreamPage is how many outbox events are read at a time when catching
+// up
+const orderStreamPage = 500
+
+// orderStreamRetry is the wait before listening again after the listener fails
+const orderStreamRetry = 5 * time.Second
+
+// orderStreamWindow is how far below the highest seq seen a seq that has not
+// arrived yet is still waited for. Beyond it, the seq is taken to belong to a
+// transaction that rolled back.
+const orderStreamWindow = 1000
+
+type OrderStreamInterface interface {
+	// StreamOrderChanges calls fn with every order change matching filter,
+	// first those after position and then new ones as they are committed.
+	// It returns when ctx is done, when the stream is closed for shutdown or
+	// when the caller falls too far behind; the caller can then resume from
+	// the Position of the last change it received. A nil position only
+	// streams new changes.
+	StreamOrderChanges(ctx context.Context, filter *models.OrderFilter, position *models.StreamPosition, fn func(*models.OrderChange) error) error
+}
+
+// OrderStream fans order changes out to subscribers. Changes come from the
+// outbox as it is committed by any instance sharing the database.
+type OrderStream struct {
+	repo     repository.OutboxRepository
+	listener repository.OutboxListener
+
+	mu     sync.Mutex
+	subs   map[*orderSubscriber]struct{}
+	seen   *seqWindow
+	closed bool
+}
+
+// orderSubscriber receives every change; its stream applies the filter
+type orderSubscriber struct {
+	changes chan *models.OrderChange
+}
+
+func NewOrderStream(repo repository.OutboxRepository, listener repository.OutboxListener) *OrderStream {
+	return &OrderStream{
+		repo:     repo,
+		listener: listener,
+		subs:     map[*orderSubscriber]struct{}{},
+		seen:     newSeqWindow(models.StreamPosition{}),
+	}
+}
+
+// Run passes committed changes to subscribers until ctx is done, listening
+// again whenever the listener fails
+func (s *OrderStream) Run(ctx context.Context) {
+	// Catching up after a reconnect starts from here until the first change
+	// is broadcast
+	for {
+		seq, err := s.repo.LatestSeq(ctx)
+		if err == nil {
+			s.mu.Lock()
+			if seq > s.seen.high {
+				s.seen = newSeqWindow(models.StreamPosition{Seq: seq})
+			}
+			s.mu.Unlock()
+			break
+		}
+		log.Printf("Failed to get latest order change: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(orderStreamRetry):
+		}
+	}
+
+	for {
+		err := s.listener.Listen(ctx, func(seq int64) { s.notify(ctx, seq) })
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Order stream listener failed: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(orderStreamRetry):
+		}
+		// Pick up whatever was committed while nobody was listening
+		s.notify(ctx, 0)
+	}
+}
+
+// Close ends every stream and refuses new ones. It is called when the server
+// shuts down, which would otherwise wait for streams that never finish.
+func (s *OrderStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for sub := range s.subs {
+		close(sub.changes)
+		delete(s.subs, sub)
+	}
+}
+
+func (s *OrderStream) StreamOrderChanges(ctx context.Context, filter *models.OrderFilter, position *models.StreamPosition, fn func(*models.OrderChange) error) error {
+	if filter == nil {
+		filter = &models.OrderFilter{}
+	}
+	sub := &orderSubscriber{changes: make(chan *models.OrderChange, orderStreamBuffer)}
+	seen, ok := s.subscribe(sub)
+	if !ok {
+		return nil
+	}
+	defer s.unsubscribe(sub)
+
+	// Every change, matching or not, is recorded as seen, so that the
+	// position covers it and a change arriving twice, from the replay and
+	// live or from a catch-up, is delivered once
+	deliver := func(change *models.OrderChange) error {
+		if !seen.pass(change.Seq) || !filter.Matches(change.Data.Order) {
+			return nil
+		}
+		delivered := *change
+		delivered.Position = seen.position()
+		return fn(&delivered)
+	}
+
+	// Subscribing first buffers live changes during the replay
+	if position != nil {
+		seen = newSeqWindow(*position)
+		if err := s.catchUp(ctx, seen.from(), deliver); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change, ok := <-sub.changes:
+			if !ok {
+				return nil
+			}
+			if err := deliver(change); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// subscribe adds sub unless the stream is closed, and returns what has been
+// seen so far, from which a stream without a position starts
+func (s *OrderStream) subscribe(sub *orderSubscriber) (*seqWindow, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, false
+	}
+	s.subs[sub] = struct{}{}
+	return s.seen.clone(), true
+}
+
+func (s *OrderStream) unsubscribe(sub *orderSubscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[sub]; ok {
+		close(sub.changes)
+		delete(s.subs, sub)
+	}
+}
+
+// notify broadcasts the change at seq, or every change not seen yet when seq
+// is 0
+func (s *OrderStream) notify(ctx context.Context, seq int64) {
+	if seq == 0 {
+		s.mu.Lock()
+		from := s.seen.from()
+		s.mu.Unlock()
+		if err := s.catchUp(ctx, from, func(change *models.OrderChange) error {
+			s.broadcast(change)
+			return nil
+		}); err != nil {
+			log.Printf("Failed to catch up on order changes: %v", err)
+		}
+		return
+	}
+
+	// Seqs are allocated before commit, so notifications can arrive out of
+	// order; each is loaded by its own seq rather than as a range
+	event, err := s.repo.GetEvent(ctx, seq)
+	if err != nil {
+		log.Printf("Failed to load order change %d: %v", seq, err)
+		return
+	}
+	if event == nil {
+		return
+	}
+	change, err := decodeOrderChange(event)
+	if err != nil {
+		log.Printf("Skipping order change: %v", err)
+		return
+	}
+	s.broadcast(change)
+}
+
+// catchUp calls fn with every change recorded after seq, lowest seq first
+func (s *OrderStream) catchUp(ctx context.Context, seq int64, fn func(*models.OrderChange) error) error {
+	for {
+		events, err := s.repo.ListAfter(ctx, seq, orderStreamPage)
+		if err != nil {
+			return err
+		}
+		for i := range events {
+			seq = events[i].Seq
+			change, err := decodeOrderChange(&events[i])
+			if err != nil {
+				log.Printf("Skipping order change: %v", err)
+				continue
+			}
+			if err := fn(change); err != nil {
+				return err
+			}
+		}
+		if len(events) < orderStreamPage {
+			return nil
+		}
+	}
+}
+
+// broadcast passes a change not seen before to every subscriber
+func (s *OrderStream) broadcast(change *models.OrderChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.seen.pass(change.Seq) {
+		return
+	}
+	for sub := range s.subs {
+		select {
+		case sub.changes <- change:
+		default:
+			// A subscriber this far behind is dropped rather than allowed to
+			// hold up the others; it can resume from its last position
+			close(sub.changes)
+			delete(s.subs, sub)
+		}
+	}
+}
+
+func decodeOrderChange(event *models.OutboxEvent) (*models.OrderChange, error) {
+	change := &models.OrderChange{Seq: event.Seq, Type: event.Event.Type}
+	if err := json.Unmarshal(event.Event.Data, &change.Data); err != nil {
+		return nil, fmt.Errorf("failed to decode outbox event %d: %w", event.Seq, err)
+	}
+	if change.Data.Order == nil {
+		return nil, fmt.Errorf("outbox event %d has no order", event.Seq)
+	}
+	return change, nil
+}
+
+// seqWindow records which outbox seqs have been seen. Below the highest seq
+// seen it keeps the seqs that have not arrived yet, since a transaction that
+// is slow to commit publishes its seq after higher ones.
+type seqWindow struct {
+	high    int64
+	missing map[int64]struct{}
+}
+
+func newSeqWindow(position models.StreamPosition) *seqWindow {
+	w := &seqWindow{high: position.Seq, missing: map[int64]struct{}{}}
+	for _, seq := range position.Pending {
+		if seq < w.high {
+			w.missing[seq] = struct{}{}
+		}
+	}
+	return w
+}
+
+func (w *seqWindow) clone() *seqWindow {
+	c := &seqWindow{high: w.high, missing: make(map[int64]struct{}, len(w.missing))}
+	for seq := range w.missing {
+		c.missing[seq] = struct{}{}
+	}
+	return c
+}
+
+// pass records seq as seen and reports whether it had not been seen before
+func (w *seqWindow) pass(seq int64) bool {
+	if seq > w.high {
+		for missing := max(w.high+1, seq-orderStreamWindow); missing < seq; missing++ {
+			w.missing[missing] = struct{}{}
+		}
+		w.high = seq
+		for missing := range w.missing {
+			if missing < w.high-orderStreamWindow {
+				delete(w.missing, missing)
+			}
+		}
+		return true
+	}
+	if _, ok := w.missing[seq]; ok {
+		delete(w.missing, seq)
+		return true
+	}
+	return false
+}
+
+// from is the seq after which every seq not seen yet lies
+func (w *seqWindow) from() int64 {
+	from := w.high
+	for missing := range w.missing {
+		if missing <= from {
+			from = missing - 1
+		}
+	}
+	return from
+}
+
+// position reports the window with the most recent missing seqs
+func (w *seqWindow) position() models.StreamPosition {
+	position := models.StreamPosition{Seq: w.high}
+	for missing := range w.missing {
+		position.Pending = append(position.Pending, missing)
+	}
+	sort.Slice(position.Pending, func(i, j int) bool { return position.Pending[i] < position.Pending[j] })
+	if len(position.Pending) > models.MaxPendingSeqs {
+		position.Pending = position.Pending[len(position.Pending)-models.MaxPendingSeqs:]
+	}
+	return position
+}
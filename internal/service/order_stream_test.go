@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// stubStreamRepository serves recorded outbox events to the order stream
+type stubStreamRepository struct {
+	repository.OutboxRepository
+	mu     sync.Mutex
+	events []models.OutboxEvent
+}
+
+func (r *stubStreamRepository) record(t *testing.T, seq int64, eventType string, order *models.Order) {
+	t.Helper()
+	event, err := models.NewEvent(eventType, models.OrderEventData{Order: order})
+	if err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, models.OutboxEvent{Seq: seq, Event: *event})
+}
+
+func (r *stubStreamRepository) ListAfter(ctx context.Context, seq int64, limit int) ([]models.OutboxEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []models.OutboxEvent
+	for _, e := range r.events {
+		if e.Seq > seq && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (r *stubStreamRepository) GetEvent(ctx context.Context, seq int64) (*models.OutboxEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.events {
+		if e.Seq == seq {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *stubStreamRepository) LatestSeq(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var seq int64
+	for _, e := range r.events {
+		if e.Seq > seq {
+			seq = e.Seq
+		}
+	}
+	return seq, nil
+}
+
+// stubOutboxListener notifies the seqs sent on its channel, and reports on
+// listening when it starts if that is set
+type stubOutboxListener struct {
+	seqs      chan int64
+	listening chan struct{}
+}
+
+func (l *stubOutboxListener) Listen(ctx context.Context, notify func(seq int64)) error {
+	if l.listening != nil {
+		close(l.listening)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case seq := <-l.seqs:
+			notify(seq)
+		}
+	}
+}
+
+var errStopStream = errors.New("stop")
+
+func TestOrderStream_ReplaysThenStreamsMatchingChanges(t *testing.T) {
+	repo := &stubStreamRepository{}
+	repo.record(t, 1, models.EventOrderCreated, &models.Order{ID: 1, CustomerID: "cust-1"})
+	repo.record(t, 2, models.EventOrderCreated, &models.Order{ID: 2, CustomerID: "cust-2"})
+	repo.record(t, 3, models.EventOrderStatusChanged, &models.Order{ID: 1, CustomerID: "cust-1", Status: "processing"})
+
+	listener := &stubOutboxListener{seqs: make(chan int64), listening: make(chan struct{})}
+	s := NewOrderStream(repo, listener)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	<-listener.listening
+
+	var got []int64
+	filter := &models.OrderFilter{CustomerIDs: []string{"cust-1"}}
+	done := make(chan error)
+	go func() {
+		done <- s.StreamOrderChanges(ctx, filter, &models.StreamPosition{Seq: 1}, func(change *models.OrderChange) error {
+			got = append(got, change.Seq)
+			if change.Seq == 3 {
+				// Live notifications of a replayed change and of a new one
+				repo.record(t, 4, models.EventOrderCreated, &models.Order{ID: 3, CustomerID: "cust-1"})
+				go func() {
+					listener.seqs <- 3
+					listener.seqs <- 4
+				}()
+			}
+			if change.Seq == 4 {
+				return errStopStream
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errStopStream) {
+			t.Fatalf("expected the stream to stop at seq 4, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream did not receive the live change")
+	}
+	if len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Errorf("expected seqs [3 4], got %v", got)
+	}
+}
+
+func TestOrderStream_CatchesUpFromLatestSeqBeforeAnyBroadcast(t *testing.T) {
+	repo := &stubStreamRepository{}
+	repo.record(t, 1, models.EventOrderCreated, &models.Order{ID: 1, CustomerID: "cust-1"})
+
+	listener := &stubOutboxListener{seqs: make(chan int64), listening: make(chan struct{})}
+	s := NewOrderStream(repo, listener)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	<-listener.listening
+
+	var got []int64
+	done := make(chan error)
+	go func() {
+		done <- s.StreamOrderChanges(ctx, nil, nil, func(change *models.OrderChange) error {
+			got = append(got, change.Seq)
+			return errStopStream
+		})
+	}()
+	waitForSubscribers(t, s, 1)
+
+	// A change committed while the connection was lost is only reported by
+	// the catch-up after the reconnect
+	repo.record(t, 2, models.EventOrderCreated, &models.Order{ID: 2, CustomerID: "cust-1"})
+	listener.seqs <- 0
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errStopStream) {
+			t.Fatalf("expected the stream to stop at seq 2, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream did not receive the missed change")
+	}
+	if len(got) != 1 || got[0] != 2 {
+		t.Errorf("expected seqs [2], got %v", got)
+	}
+}
+
+// collectChanges streams into a channel until ctx is done
+func collectChanges(ctx context.Context, s *OrderStream, position *models.StreamPosition) <-chan *models.OrderChange {
+	changes := make(chan *models.OrderChange, 10)
+	go s.StreamOrderChanges(ctx, nil, position, func(change *models.OrderChange) error {
+		changes <- change
+		return nil
+	})
+	return changes
+}
+
+func expectChange(t *testing.T, changes <-chan *models.OrderChange, seq int64, position string) {
+	t.Helper()
+	select {
+	case change := <-changes:
+		if change.Seq != seq || change.Position.String() != position {
+			t.Errorf("expected seq %d at %s, got seq %d at %s", seq, position, change.Seq, change.Position)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected seq %d", seq)
+	}
+}
+
+func expectNoChange(t *testing.T, changes <-chan *models.OrderChange) {
+	t.Helper()
+	select {
+	case change := <-changes:
+		t.Errorf("expected no further change, got seq %d", change.Seq)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// In the tests below seq 12 is allocated before seq 13 but commits after it
+
+func TestOrderStream_SeqCommittedLateIsStreamedLiveAndAfterReconnect(t *testing.T) {
+	repo := &stubStreamRepository{}
+	repo.record(t, 11, models.EventOrderCreated, &models.Order{ID: 1})
+	listener := &stubOutboxListener{seqs: make(chan int64), listening: make(chan struct{})}
+	s := NewOrderStream(repo, listener)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	<-listener.listening
+
+	changes := collectChanges(ctx, s, nil)
+	waitForSubscribers(t, s, 1)
+
+	repo.record(t, 13, models.EventOrderCreated, &models.Order{ID: 3})
+	listener.seqs <- 13
+	expectChange(t, changes, 13, "13:12")
+
+	repo.record(t, 12, models.EventOrderCreated, &models.Order{ID: 2})
+	listener.seqs <- 12
+	expectChange(t, changes, 12, "13")
+
+	// Missed while the connection was lost
+	repo.record(t, 15, models.EventOrderCreated, &models.Order{ID: 5})
+	listener.seqs <- 15
+	expectChange(t, changes, 15, "15:14")
+	repo.record(t, 14, models.EventOrderCreated, &models.Order{ID: 4})
+	listener.seqs <- 0
+	expectChange(t, changes, 14, "15")
+	expectNoChange(t, changes)
+}
+
+func TestOrderStream_ResumeDeliversPendingSeq(t *testing.T) {
+	repo := &stubStreamRepository{}
+	repo.record(t, 11, models.EventOrderCreated, &models.Order{ID: 1})
+	repo.record(t, 13, models.EventOrderCreated, &models.Order{ID: 3})
+	repo.record(t, 12, models.EventOrderCreated, &models.Order{ID: 2})
+	s := NewOrderStream(repo, &stubOutboxListener{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := collectChanges(ctx, s, &models.StreamPosition{Seq: 13, Pending: []int64{12}})
+	expectChange(t, changes, 12, "13")
+	expectNoChange(t, changes)
+}
+
+func TestOrderStream_SeqCommittedLateDuringReplay(t *testing.T) {
+	repo := &stubStreamRepository{}
+	repo.record(t, 13, models.EventOrderCreated, &models.Order{ID: 3})
+	s := NewOrderStream(repo, &stubOutboxListener{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := collectChanges(ctx, s, &models.StreamPosition{Seq: 11})
+	expectChange(t, changes, 13, "13:12")
+
+	// Live notifications of the replayed change and of the late one
+	repo.record(t, 12, models.EventOrderCreated, &models.Order{ID: 2})
+	s.notify(ctx, 13)
+	s.notify(ctx, 12)
+	expectChange(t, changes, 12, "13")
+	expectNoChange(t, changes)
+}
+
+func TestOrderStream_CloseEndsStreams(t *testing.T) {
+	s := NewOrderStream(&stubStreamRepository{}, &stubOutboxListener{})
+	done := make(chan error)
+	go func() {
+		done <- s.StreamOrderChanges(context.Background(), nil, nil, func(*models.OrderChange) error { return nil })
+	}()
+
+	waitForSubscribers(t, s, 1)
+
+	s.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not end the stream")
+	}
+
+	if err := s.StreamOrderChanges(context.Background(), nil, nil, func(*models.OrderChange) error { return nil }); err != nil {
+		t.Errorf("expected a closed stream to return at once, got %v", err)
+	}
+}
+
+func waitForSubscribers(t *testing.T, s *OrderStream, n int) {
+	t.Helper()
+	for i := 0; ; i++ {
+		s.mu.Lock()
+		subscribed := len(s.subs) == n
+		s.mu.Unlock()
+		if subscribed {
+			return
+		}
+		if i == 100 {
+			t.Fatal("stream did not subscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOrderStream_DropsLaggingSubscriber(t *testing.T) {
+	s := NewOrderStream(&stubStreamRepository{}, &stubOutboxListener{})
+	sub := &orderSubscriber{changes: make(chan *models.OrderChange, 1)}
+	s.subscribe(sub)
+
+	order := &models.Order{ID: 1}
+	s.broadcast(&models.OrderChange{Seq: 1, Data: models.OrderEventData{Order: order}})
+	s.broadcast(&models.OrderChange{Seq: 2, Data: models.OrderEventData{Order: order}})
+
+	if change := <-sub.changes; change == nil || change.Seq != 1 {
+		t.Fatalf("expected the buffered change, got %+v", change)
+	}
+	if _, ok := <-sub.changes; ok {
+		t.Error("expected the lagging subscriber's channel to be closed")
+	}
+	if len(s.subs) != 0 {
+		t.Error("expected the lagging subscriber to be removed")
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// OutboxDispatcher publishes the events that the order repository writes to
+// the outbox in the same transaction as the change they describe. Several
+// dispatchers, in one process or many, can run against the same database.
+type OutboxDispatcher struct {
+	repo      repository.OutboxRepository
+	publisher Publisher
+	batchSize int
+	lease     time.Duration
+	retryBase time.Duration
+	retryMax  time.Duration
+}
+
+// NewOutboxDispatcher creates a dispatcher that claims up to batchSize events
+// at a time for lease, which should outlast publishing a whole batch. An
+// event that fails to publish is retried after retryBase, doubling after each
+// further failure up to retryMax, until it is published.
+func NewOutboxDispatcher(repo repository.OutboxRepository, publisher Publisher, batchSize int, lease, retryBase, retryMax time.Duration) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		repo:      repo,
+		publisher: publisher,
+		batchSize: batchSize,
+		lease:     lease,
+		retryBase: retryBase,
+		retryMax:  retryMax,
+	}
+}
+
+// Run publishes due events every interval until ctx is cancelled. A batch
+// being published when ctx is cancelled is cut short and its unpublished
+// events released, so once Run returns no dispatch is in flight.
+func (d *OutboxDispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep going while full batches come back, so a backlog drains
+			// without waiting for further ticks
+			for ctx.Err() == nil {
+				claimed, err := d.DispatchBatch(ctx)
+				if err != nil {
+					log.Printf("Failed to dispatch outbox events: %v", err)
+					break
+				}
+				if claimed < d.batchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// DispatchBatch publishes one batch of due events and returns how many were
+// claimed. No transaction is held while publishing: the claim is a lease, and
+// an event whose outcome cannot be recorded is published again once it ends.
+// When ctx is cancelled the events not yet published are released instead of
+// waiting out the lease.
+func (d *OutboxDispatcher) DispatchBatch(ctx context.Context) (int, error) {
+	events, err := d.repo.ClaimDue(ctx, d.batchSize, d.lease)
+	if err != nil {
+		return 0, err
+	}
+	// Outcomes are recorded even after ctx is cancelled
+	record := context.WithoutCancel(ctx)
+	for i := range events {
+		if ctx.Err() != nil {
+			d.release(record, events[i:])
+			break
+		}
+		d.publish(ctx, record, &events[i])
+	}
+	return len(events), nil
+}
+
+func (d *OutboxDispatcher) publish(ctx, record context.Context, e *models.OutboxEvent) {
+	if err := d.publisher.Publish(ctx, &e.Event); err != nil {
+		if ctx.Err() != nil {
+			// Cut short by shutdown rather than failed
+			d.release(record, []models.OutboxEvent{*e})
+			return
+		}
+		log.Printf("Failed to publish %s event %s: %v", e.Event.Type, e.Event.ID, err)
+		retryAfter := RetryDelay(e.Attempts+1, d.retryBase, d.retryMax)
+		if err := d.repo.MarkFailed(record, e.Seq, err.Error(), retryAfter); err != nil {
+			log.Printf("Failed to record outbox publish failure: %v", err)
+		}
+		return
+	}
+	if err := d.repo.MarkSent(record, e.Seq); err != nil {
+		log.Printf("Failed to mark outbox event sent: %v", err)
+	}
+}
+
+func (d *OutboxDispatcher) release(ctx context.Context, events []models.OutboxEvent) {
+	seqs := make([]int64, len(events))
+	for i := range events {
+		seqs[i] = events[i].Seq
+	}
+	if err := d.repo.Release(ctx, seqs); err != nil {
+		log.Printf("Failed to release outbox events: %v", err)
+	}
+}
+
+// RunSweeper deletes events sent more than retention ago every interval
+// until ctx is cancelled. Retention bounds how far back order streams can
+// resume.
+func (d *OutboxDispatcher) RunSweeper(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := d.repo.DeleteSent(ctx, retention)
+			if err != nil {
+				log.Printf("Failed to sweep outbox events: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("Swept %d sent outbox events", deleted)
+			}
+		}
+	}
+}
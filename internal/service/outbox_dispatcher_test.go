@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// stubOutboxRepository hands out its unsent events in order, recording which
+// were marked sent or released and the retry delay given to the others
+type stubOutboxRepository struct {
+	repository.OutboxRepository
+	unsent   []*models.Event
+	leases   []time.Duration
+	claimed  map[int64]*models.OutboxEvent
+	sent     []string
+	retries  map[string]time.Duration
+	released []string
+	swept    []time.Duration
+}
+
+func (r *stubOutboxRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	if r.claimed == nil {
+		r.claimed = map[int64]*models.OutboxEvent{}
+		r.retries = map[string]time.Duration{}
+	}
+	r.leases = append(r.leases, lease)
+	batch := r.unsent
+	if len(batch) > limit {
+		batch = batch[:limit]
+	}
+	r.unsent = r.unsent[len(batch):]
+
+	var events []models.OutboxEvent
+	for _, event := range batch {
+		seq := int64(len(r.claimed) + 1)
+		r.claimed[seq] = &models.OutboxEvent{Seq: seq, Event: *event}
+		events = append(events, *r.claimed[seq])
+	}
+	return events, nil
+}
+
+func (r *stubOutboxRepository) MarkSent(ctx context.Context, seq int64) error {
+	r.sent = append(r.sent, r.claimed[seq].Event.ID)
+	return nil
+}
+
+func (r *stubOutboxRepository) Release(ctx context.Context, seqs []int64) error {
+	for _, seq := range seqs {
+		r.released = append(r.released, r.claimed[seq].Event.ID)
+	}
+	return nil
+}
+
+func (r *stubOutboxRepository) MarkFailed(ctx context.Context, seq int64, publishErr string, retryAfter time.Duration) error {
+	r.retries[r.claimed[seq].Event.ID] = retryAfter
+	return nil
+}
+
+func (r *stubOutboxRepository) DeleteSent(ctx context.Context, olderThan time.Duration) (int64, error) {
+	r.swept = append(r.swept, olderThan)
+	return 0, nil
+}
+
+// publisherFunc adapts a function to the Publisher interface
+type publisherFunc func(ctx context.Context, event *models.Event) error
+
+func (f publisherFunc) Publish(ctx context.Context, event *models.Event) error {
+	return f(ctx, event)
+}
+
+func newTestEvent(t *testing.T, id string) *models.Event {
+	t.Helper()
+	event, err := models.NewEvent(models.EventOrderCreated, map[string]string{"customer_id": "cust-1"})
+	if err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+	event.ID = id
+	return event
+}
+
+func TestOutboxDispatcher_MarksPublishedAndRetriesFailed(t *testing.T) {
+	repo := &stubOutboxRepository{unsent: []*models.Event{newTestEvent(t, "evt-1"), newTestEvent(t, "evt-2")}}
+	publisher := publisherFunc(func(ctx context.Context, event *models.Event) error {
+		if event.ID == "evt-2" {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	})
+	d := NewOutboxDispatcher(repo, publisher, 10, time.Hour, time.Second, time.Minute)
+
+	claimed, err := d.DispatchBatch(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claimed != 2 {
+		t.Errorf("expected 2 events claimed, got %d", claimed)
+	}
+	if len(repo.sent) != 1 || repo.sent[0] != "evt-1" {
+		t.Errorf("expected only evt-1 to be sent, got %v", repo.sent)
+	}
+	if repo.retries["evt-2"] != time.Second {
+		t.Errorf("expected evt-2 to be retried after 1s, got %v", repo.retries["evt-2"])
+	}
+	if len(repo.leases) != 1 || repo.leases[0] != time.Hour {
+		t.Errorf("expected one claim leased for 1h, got %v", repo.leases)
+	}
+}
+
+func TestOutboxDispatcher_ReleasesUnpublishedOnCancel(t *testing.T) {
+	repo := &stubOutboxRepository{unsent: []*models.Event{
+		newTestEvent(t, "evt-1"), newTestEvent(t, "evt-2"), newTestEvent(t, "evt-3"),
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	publisher := publisherFunc(func(ctx context.Context, event *models.Event) error {
+		if event.ID == "evt-2" {
+			// Shutdown while the event is being published
+			cancel()
+			return ctx.Err()
+		}
+		return nil
+	})
+	d := NewOutboxDispatcher(repo, publisher, 10, time.Hour, time.Second, time.Minute)
+
+	if _, err := d.DispatchBatch(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.sent) != 1 || repo.sent[0] != "evt-1" {
+		t.Errorf("expected evt-1 to be marked sent, got %v", repo.sent)
+	}
+	if strings.Join(repo.released, ",") != "evt-2,evt-3" {
+		t.Errorf("expected evt-2 and evt-3 to be released, got %v", repo.released)
+	}
+	if len(repo.retries) != 0 {
+		t.Errorf("expected no failed attempts to be recorded, got %v", repo.retries)
+	}
+}
+
+func TestOutboxDispatcher_RunSweeper(t *testing.T) {
+	repo := &stubOutboxRepository{}
+	d := NewOutboxDispatcher(repo, MultiPublisher{}, 10, time.Hour, time.Second, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	d.RunSweeper(ctx, 10*time.Millisecond, 7*24*time.Hour)
+	if len(repo.swept) == 0 || repo.swept[0] != 7*24*time.Hour {
+		t.Errorf("expected sweeps keeping 7 days of events, got %v", repo.swept)
+	}
+}
+
+func TestOutboxDispatcher_RunDrainsBacklogAndStops(t *testing.T) {
+	repo := &stubOutboxRepository{}
+	for _, id := range []string{"evt-1", "evt-2", "evt-3", "evt-4", "evt-5"} {
+		repo.unsent = append(repo.unsent, newTestEvent(t, id))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	published := make(chan string, 5)
+	publisher := publisherFunc(func(_ context.Context, event *models.Event) error {
+		published <- event.ID
+		return nil
+	})
+	d := NewOutboxDispatcher(repo, publisher, 2, time.Hour, time.Second, time.Minute)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx, time.Millisecond)
+	}()
+	// A batch size of 2 takes three batches, which should not need a tick each
+	for i := 0; i < 5; i++ {
+		select {
+		case <-published:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d events published", i)
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+	if len(repo.sent) != 5 {
+		t.Errorf("expected 5 events sent, got %v", repo.sent)
+	}
+}
+
+func TestMultiPublisher_FailsIfAnyPublisherFails(t *testing.T) {
+	webhooks := &stubWebhookRepository{}
+	failing := publisherFunc(func(ctx context.Context, event *models.Event) error {
+		return errors.New("broker unavailable")
+	})
+	event := newTestEvent(t, "evt-1")
+
+	err := MultiPublisher{NewWebhookService(webhooks), failing}.Publish(context.Background(), event)
+	if err == nil || !strings.Contains(err.Error(), "broker unavailable") {
+		t.Errorf("expected the failing publisher's error, got %v", err)
+	}
+	if len(webhooks.enqueued) != 1 || webhooks.enqueued[0].ID != "evt-1" {
+		t.Errorf("expected the event to be enqueued for webhooks, got %+v", webhooks.enqueued)
+	}
+}
+
+func TestHTTPPublisher(t *testing.T) {
+	var received models.Event
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		if r.Header.Get(WebhookEventIDHeader) != received.ID {
+			t.Errorf("expected event id header %q, got %q", received.ID, r.Header.Get(WebhookEventIDHeader))
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	p := NewHTTPPublisher(server.URL, time.Second)
+	if err := p.Publish(context.Background(), newTestEvent(t, "evt-1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received.ID != "evt-1" || received.Type != models.EventOrderCreated {
+		t.Errorf("unexpected event received: %+v", received)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := p.Publish(context.Background(), newTestEvent(t, "evt-2")); err == nil {
+		t.Error("expected a 503 response to fail the publish")
+	}
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	p, err := NewFilePublisher(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, id := range []string{"evt-1", "evt-2"} {
+		if err := p.Publish(context.Background(), newTestEvent(t, id)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %s", len(lines), data)
+	}
+	var event models.Event
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil || event.ID != "evt-2" {
+		t.Errorf("expected evt-2 on the second line, got %s (%v)", lines[1], err)
+	}
+}
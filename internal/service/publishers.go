@@ -0,0 +1,115 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+)
+
+// Publisher hands events to the outside world. Publish must be safe to call
+// again with an event it has already published: the outbox delivers each
+// event at least once.
+type Publisher interface {
+	Publish(ctx context.Context, event *models.Event) error
+}
+
+// MultiPublisher publishes every event to each of its publishers. An event is
+// only published when all of them accept it; otherwise it is retried on all.
+type MultiPublisher []Publisher
+
+func (m MultiPublisher) Publish(ctx context.Context, event *models.Event) error {
+	var errs []error
+	for _, p := range m {
+		if err := p.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LogPublisher writes each event to the standard logger
+type LogPublisher struct{}
+
+func (LogPublisher) Publish(ctx context.Context, event *models.Event) error {
+	log.Printf("Event %s %s: %s", event.Type, event.ID, event.Data)
+	return nil
+}
+
+// FilePublisher appends each event to a file as one line of JSON
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePublisher opens path for appending, creating it if needed
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event file: %w", err)
+	}
+	return &FilePublisher{file: file}, nil
+}
+
+func (p *FilePublisher) Publish(ctx context.Context, event *models.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write event %s: %w", event.ID, err)
+	}
+	return nil
+}
+
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
+
+// HTTPPublisher POSTs each event as JSON to a fixed URL. Any 2xx response
+// accepts the event.
+type HTTPPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPPublisher(url string, timeout time.Duration) *HTTPPublisher {
+	return &HTTPPublisher{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (p *HTTPPublisher) Publish(ctx context.Context, event *models.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventIDHeader, event.ID)
+	req.Header.Set(WebhookEventTypeHeader, event.Type)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to publish event %s: %w", event.ID, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookErrorLength))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to publish event %s: unexpected status %d", event.ID, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// maxReportBuckets bounds how many time buckets a single report may return
+const maxReportBuckets = 1000
+
+// Product reports list the top defaultProductReportLimit products unless asked
+// for more, up to maxProductReportLimit
+const (
+	defaultProductReportLimit = 10
+	maxProductReportLimit     = 100
+)
+
+// ErrReportCurrencyRequired is returned when a report would add up amounts in
+// different currencies
+var ErrReportCurrencyRequired = &Error{
+	Kind:    KindValidation,
+	Code:    "currency_required",
+	Message: "currency is required because orders exist in multiple currencies",
+	Fields:  []FieldError{{Field: "currency", Code: "required", Message: "is required because orders exist in multiple currencies"}},
+}
+
+// ReportServiceInterface defines the contract for report service
+type ReportServiceInterface interface {
+	SalesReport(ctx context.Context, query *models.SalesReportQuery) (*models.SalesReport, error)
+	CustomerSummary(ctx context.Context, customerID string) (*models.CustomerSummary, error)
+	ProductReport(ctx context.Context, query *models.ProductReportQuery) (*models.ProductReport, error)
+}
+
+// currencyLister is the part of the order repository that reports need to
+// keep amounts in different currencies apart
+type currencyLister interface {
+	ListCurrencies(ctx context.Context) ([]string, error)
+}
+
+type ReportService struct {
+	repo       repository.ReportRepository
+	currencies currencyLister
+}
+
+func NewReportService(repo repository.ReportRepository, orders repository.OrderRepository) *ReportService {
+	return &ReportService{repo: repo, currencies: orders}
+}
+
+// SalesReport returns order counts and revenue per time bucket
+func (s *ReportService) SalesReport(ctx context.Context, query *models.SalesReportQuery) (*models.SalesReport, error) {
+	if query.Interval == "" {
+		query.Interval = models.IntervalDay
+	}
+	if !query.Interval.IsValid() {
+		return nil, NewValidationError("interval", "unknown_value", fmt.Sprintf("unknown interval %q; allowed: day, week, month", query.Interval))
+	}
+	if query.GroupBy != "" && !containsString(models.SalesGroupFields, query.GroupBy) {
+		return nil, NewValidationError("group_by", "unknown_value", fmt.Sprintf("unknown group_by %q; allowed: %s", query.GroupBy, strings.Join(models.SalesGroupFields, ", ")))
+	}
+	if err := checkReportRange(query.From, query.To); err != nil {
+		return nil, err
+	}
+	if bucketCount(query.Interval, query.From, query.To) > maxReportBuckets {
+		return nil, NewValidationError("from", "range_too_large", fmt.Sprintf("the range spans more than %d %s buckets", maxReportBuckets, query.Interval))
+	}
+	if query.Filter == nil {
+		query.Filter = &models.OrderFilter{}
+	}
+
+	currency, err := reportCurrency(ctx, s.currencies, query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := s.repo.SalesReport(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SalesReport{
+		Interval: query.Interval,
+		From:     query.From.Format(time.DateOnly),
+		To:       query.To.Format(time.DateOnly),
+		Currency: currency,
+		GroupBy:  query.GroupBy,
+		Buckets:  buckets,
+	}, nil
+}
+
+// CustomerSummary returns a customer's lifetime order statistics. Every status
+// is listed in the counts, and cancelled orders do not count towards spend.
+func (s *ReportService) CustomerSummary(ctx context.Context, customerID string) (*models.CustomerSummary, error) {
+	if strings.TrimSpace(customerID) == "" {
+		return nil, NewValidationError("customer_id", "required", "customer_id is required")
+	}
+
+	summary, err := s.repo.CustomerSummary(ctx, customerID)
+	if err != nil {
+		return nil, translateRepoError(err)
+	}
+
+	for _, status := range models.OrderStatuses {
+		if _, ok := summary.StatusCounts[status]; !ok {
+			summary.StatusCounts[status] = 0
+		}
+	}
+	if summary.TotalOrders > 0 {
+		rate := float64(summary.StatusCounts[models.StatusCancelled]) / float64(summary.TotalOrders)
+		summary.CancellationRate = math.Round(rate*10000) / 10000
+	}
+	for i := range summary.Spend {
+		spend := &summary.Spend[i]
+		if spend.OrderCount > 0 {
+			spend.AverageOrderValue = spend.LifetimeSpend.DivRound(spend.OrderCount)
+		}
+	}
+	return summary, nil
+}
+
+// ProductReport returns the top products by sales over a date range. Products
+// are ranked by revenue unless the query asks otherwise.
+func (s *ReportService) ProductReport(ctx context.Context, query *models.ProductReportQuery) (*models.ProductReport, error) {
+	if err := checkReportRange(query.From, query.To); err != nil {
+		return nil, err
+	}
+	if query.Limit < 1 {
+		query.Limit = defaultProductReportLimit
+	}
+	if query.Limit > maxProductReportLimit {
+		return nil, NewValidationError("limit", "out_of_range", fmt.Sprintf("limit must be at most %d", maxProductReportLimit))
+	}
+	if query.Filter == nil {
+		query.Filter = &models.OrderFilter{}
+	}
+
+	currency, err := reportCurrency(ctx, s.currencies, query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	products, err := s.repo.ProductReport(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ProductReport{
+		From:     query.From.Format(time.DateOnly),
+		To:       query.To.Format(time.DateOnly),
+		Currency: currency,
+		Limit:    query.Limit,
+		Products: products,
+	}, nil
+}
+
+// checkReportRange requires both ends of a report's date range, in order
+func checkReportRange(from, to time.Time) error {
+	if from.IsZero() {
+		return NewValidationError("from", "required", "from is required")
+	}
+	if to.IsZero() {
+		return NewValidationError("to", "required", "to is required")
+	}
+	if from.After(to) {
+		return NewValidationError("from", "invalid_range", "from must not be after to")
+	}
+	return nil
+}
+
+// bucketCount is an upper bound on the number of interval buckets between
+// the from and to dates
+func bucketCount(interval models.ReportInterval, from, to time.Time) int {
+	days := int(to.Sub(from).Hours()/24) + 1
+	switch interval {
+	case models.IntervalWeek:
+		return days/7 + 2
+	case models.IntervalMonth:
+		return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month()) + 1
+	}
+	return days
+}
+
+// reportCurrency returns the currency a report's amounts are in, narrowing
+// filter to it. Adding up amounts in different currencies is meaningless, so
+// one must be chosen when orders exist in several; the result is empty when
+// there are no orders at all.
+func reportCurrency(ctx context.Context, currencies currencyLister, filter *models.OrderFilter) (string, error) {
+	if filter.Currency != nil {
+		currency := strings.ToUpper(*filter.Currency)
+		filter.Currency = &currency
+		return currency, nil
+	}
+
+	existing, err := currencies.ListCurrencies(ctx)
+	if err != nil {
+		return "", err
+	}
+	switch len(existing) {
+	case 0:
+		return "", nil
+	case 1:
+		filter.Currency = &existing[0]
+		return existing[0], nil
+	}
+	return "", ErrReportCurrencyRequired
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
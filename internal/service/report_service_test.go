@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+type stubCurrencyLister []string
+
+func (s stubCurrencyLister) ListCurrencies(ctx context.Context) ([]string, error) {
+	return s, nil
+}
+
+func TestReportCurrency(t *testing.T) {
+	filter := &models.OrderFilter{}
+	currency, err := reportCurrency(context.Background(), stubCurrencyLister{"EUR"}, filter)
+	if err != nil || currency != "EUR" || filter.Currency == nil || *filter.Currency != "EUR" {
+		t.Errorf("expected the only currency EUR to be used, got %q, %v", currency, err)
+	}
+
+	filter = &models.OrderFilter{}
+	if _, err := reportCurrency(context.Background(), stubCurrencyLister{"EUR", "USD"}, filter); !errors.Is(err, ErrReportCurrencyRequired) {
+		t.Errorf("expected ErrReportCurrencyRequired, got %v", err)
+	}
+
+	gbp := "gbp"
+	filter = &models.OrderFilter{Currency: &gbp}
+	currency, err = reportCurrency(context.Background(), stubCurrencyLister{"EUR", "USD"}, filter)
+	if err != nil || currency != "GBP" {
+		t.Errorf("expected requested currency GBP, got %q, %v", currency, err)
+	}
+}
+
+func TestSalesReport_Validation(t *testing.T) {
+	s := NewReportService(nil, nil)
+	jan1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		query models.SalesReportQuery
+		field string
+	}{
+		{"unknown interval", models.SalesReportQuery{Interval: "hour", From: jan1, To: jan1}, "interval"},
+		{"unknown group", models.SalesReportQuery{GroupBy: "product_id", From: jan1, To: jan1}, "group_by"},
+		{"missing from", models.SalesReportQuery{To: jan1}, "from"},
+		{"missing to", models.SalesReportQuery{From: jan1}, "to"},
+		{"reversed range", models.SalesReportQuery{From: jan1, To: jan1.AddDate(0, 0, -1)}, "from"},
+		{"too many buckets", models.SalesReportQuery{From: jan1, To: jan1.AddDate(3, 0, 0)}, "from"},
+	}
+	for _, tt := range tests {
+		_, err := s.SalesReport(context.Background(), &tt.query)
+		var domainErr *Error
+		if !errors.As(err, &domainErr) || len(domainErr.Fields) != 1 || domainErr.Fields[0].Field != tt.field {
+			t.Errorf("%s: expected a validation error on %s, got %v", tt.name, tt.field, err)
+		}
+	}
+}
+
+type stubReportRepository struct {
+	summary *models.CustomerSummary
+	err     error
+}
+
+func (s *stubReportRepository) SalesReport(ctx context.Context, query *models.SalesReportQuery) ([]models.SalesBucket, error) {
+	return nil, nil
+}
+
+func (s *stubReportRepository) ProductReport(ctx context.Context, query *models.ProductReportQuery) ([]models.ProductSales, error) {
+	return []models.ProductSales{}, nil
+}
+
+func (s *stubReportRepository) CustomerSummary(ctx context.Context, customerID string) (*models.CustomerSummary, error) {
+	return s.summary, s.err
+}
+
+func TestCustomerSummary_DerivedMetrics(t *testing.T) {
+	repo := &stubReportRepository{summary: &models.CustomerSummary{
+		CustomerID:   "cust-1",
+		TotalOrders:  3,
+		StatusCounts: map[models.OrderStatus]int64{models.StatusDelivered: 2, models.StatusCancelled: 1},
+		Spend:        []models.CustomerSpend{{Currency: "USD", OrderCount: 2, LifetimeSpend: 1001}},
+	}}
+	summary, err := NewReportService(repo, nil).CustomerSummary(context.Background(), "cust-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(summary.StatusCounts) != len(models.OrderStatuses) || summary.StatusCounts[models.StatusPending] != 0 {
+		t.Errorf("expected every status to be counted, got %v", summary.StatusCounts)
+	}
+	if summary.CancellationRate != 0.3333 {
+		t.Errorf("expected cancellation rate 0.3333, got %v", summary.CancellationRate)
+	}
+	if summary.Spend[0].AverageOrderValue != 501 {
+		t.Errorf("expected average order value 5.01, got %s", summary.Spend[0].AverageOrderValue)
+	}
+}
+
+func TestCustomerSummary_NotFound(t *testing.T) {
+	repo := &stubReportRepository{err: repository.ErrCustomerNotFound}
+	_, err := NewReportService(repo, nil).CustomerSummary(context.Background(), "nobody")
+	if !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("expected ErrCustomerNotFound, got %v", err)
+	}
+}
+
+func TestProductReport_Limit(t *testing.T) {
+	s := &ReportService{repo: &stubReportRepository{}, currencies: stubCurrencyLister{"USD"}}
+	jan1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	report, err := s.ProductReport(context.Background(), &models.ProductReportQuery{From: jan1, To: jan1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Limit != defaultProductReportLimit || report.Currency != "USD" {
+		t.Errorf("expected default limit and currency USD, got %d %q", report.Limit, report.Currency)
+	}
+
+	_, err = s.ProductReport(context.Background(), &models.ProductReportQuery{From: jan1, To: jan1, Limit: maxProductReportLimit + 1})
+	if !errors.Is(err, &Error{Code: CodeValidationFailed}) {
+		t.Errorf("expected a validation error for a limit above the maximum, got %v", err)
+	}
+}
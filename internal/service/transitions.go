@@ -0,0 +1,50 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/sabina/orders-api/internal/models"
+)
+
+// orderTransitions lists the statuses an order may move to from each status.
+// Delivered and cancelled are terminal.
+var orderTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.StatusPending:    {models.StatusProcessing, models.StatusCancelled},
+	models.StatusProcessing: {models.StatusShipped, models.StatusCancelled},
+	models.StatusShipped:    {models.StatusDelivered},
+	models.StatusDelivered:  {},
+	models.StatusCancelled:  {},
+}
+
+// AllowedTransitions returns the statuses reachable from the given status
+func AllowedTransitions(from models.OrderStatus) []models.OrderStatus {
+	allowed := orderTransitions[from]
+	result := make([]models.OrderStatus, len(allowed))
+	copy(result, allowed)
+	return result
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to models.OrderStatus) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError is returned when a status change is not permitted by the
+// transition table
+type TransitionError struct {
+	From    models.OrderStatus
+	To      models.OrderStatus
+	Allowed []models.OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	if e.To == models.StatusCancelled {
+		return fmt.Sprintf("cannot cancel an order that is %s; only pending and processing orders can be cancelled", e.From)
+	}
+	return fmt.Sprintf("cannot transition order from %s to %s", e.From, e.To)
+}
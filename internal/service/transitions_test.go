@@ -0,0 +1,36 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/sabina/orders-api/internal/models"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to models.OrderStatus
+		want     bool
+	}{
+		{models.StatusPending, models.StatusProcessing, true},
+		{models.StatusPending, models.StatusCancelled, true},
+		{models.StatusProcessing, models.StatusShipped, true},
+		{models.StatusShipped, models.StatusDelivered, true},
+		{models.StatusPending, models.StatusPending, false},
+		{models.StatusDelivered, models.StatusPending, false},
+		{models.StatusCancelled, models.StatusShipped, false},
+		{models.StatusShipped, models.StatusCancelled, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestAllowedTransitions_Terminal(t *testing.T) {
+	for _, status := range []models.OrderStatus{models.StatusDelivered, models.StatusCancelled} {
+		if allowed := AllowedTransitions(status); len(allowed) != 0 {
+			t.Errorf("expected %s to be terminal, got %v", status, allowed)
+		}
+	}
+}
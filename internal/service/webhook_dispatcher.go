@@ -0,0 +1,197 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookEventIDHeader   = "X-Webhook-Id"
+	WebhookEventTypeHeader = "X-Webhook-Event"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// webhookBatchSize is how many due deliveries are claimed at a time
+const webhookBatchSize = 20
+
+// maxWebhookErrorLength bounds the response excerpt kept in last_error
+const maxWebhookErrorLength = 512
+
+// WebhookDispatcher sends queued webhook deliveries. Failed deliveries are
+// retried with exponential backoff until maxAttempts have been made, after
+// which they are marked dead.
+type WebhookDispatcher struct {
+	repo        repository.WebhookRepository
+	client      *http.Client
+	maxAttempts int
+	retryBase   time.Duration
+	retryMax    time.Duration
+	now         func() time.Time
+}
+
+// NewWebhookDispatcher creates a dispatcher whose requests time out after
+// timeout. Redirects are not followed: a 3xx response is a failed attempt.
+func NewWebhookDispatcher(repo repository.WebhookRepository, timeout time.Duration, maxAttempts int, retryBase, retryMax time.Duration) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		repo: repo,
+		client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxAttempts: maxAttempts,
+		retryBase:   retryBase,
+		retryMax:    retryMax,
+		now:         time.Now,
+	}
+}
+
+// Run sends due deliveries every interval until ctx is cancelled. A batch in
+// flight when ctx is cancelled is abandoned; its deliveries become due again
+// once their lease runs out.
+func (d *WebhookDispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep going while full batches come back, so a backlog drains
+			// without waiting for the next tick
+			for {
+				sent, err := d.DispatchDue(ctx)
+				if err != nil {
+					log.Printf("Failed to dispatch webhooks: %v", err)
+					break
+				}
+				if sent < webhookBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// DispatchDue claims one batch of due deliveries, sends them and records the
+// outcome of each. It returns how many deliveries were attempted.
+func (d *WebhookDispatcher) DispatchDue(ctx context.Context) (int, error) {
+	// The lease outlasts the slowest possible batch so that no other
+	// dispatcher picks up a delivery that is still being sent
+	lease := d.client.Timeout*webhookBatchSize + time.Minute
+	deliveries, err := d.repo.ClaimDueDeliveries(ctx, webhookBatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range deliveries {
+		attempt := d.send(ctx, &deliveries[i])
+		if ctx.Err() != nil {
+			return i, ctx.Err()
+		}
+		if err := d.repo.RecordAttempt(ctx, deliveries[i].ID, attempt); err != nil {
+			return i, err
+		}
+		if attempt.Status == models.DeliveryDead {
+			log.Printf("Webhook delivery %d of event %s to %s is dead after %d attempts: %s",
+				deliveries[i].ID, deliveries[i].EventID, deliveries[i].URL, deliveries[i].Attempts+1, attempt.Error)
+		}
+	}
+	return len(deliveries), nil
+}
+
+// send POSTs one delivery and decides what happens to it next
+func (d *WebhookDispatcher) send(ctx context.Context, delivery *models.WebhookDelivery) *models.DeliveryAttempt {
+	now := d.now()
+	attempt := &models.DeliveryAttempt{Status: models.DeliveryDelivered}
+
+	statusCode, err := d.post(ctx, delivery, now)
+	if statusCode != 0 {
+		attempt.StatusCode = &statusCode
+	}
+	if err == nil {
+		return attempt
+	}
+
+	attempt.Error = err.Error()
+	attempts := delivery.Attempts + 1
+	if attempts >= d.maxAttempts {
+		attempt.Status = models.DeliveryDead
+		return attempt
+	}
+	retryAfter := RetryDelay(attempts, d.retryBase, d.retryMax)
+	attempt.Status = models.DeliveryPending
+	attempt.RetryAfter = &retryAfter
+	return attempt
+}
+
+// post sends the delivery's payload, signed with the subscription's secret. It
+// returns the response status, if any, and an error unless the status is 2xx.
+func (d *WebhookDispatcher) post(ctx context.Context, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "orders-api-webhooks/1")
+	req.Header.Set(WebhookEventIDHeader, delivery.EventID)
+	req.Header.Set(WebhookEventTypeHeader, delivery.EventType)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookErrorLength))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, excerpt)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook computes the signature header of a delivery: the hex HMAC-SHA256,
+// keyed with the subscription's secret, of the timestamp header, a dot and the
+// body. Receivers recompute it to check that a delivery is authentic, and
+// reject old timestamps to stop replays.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// RetryDelay is the wait before the next attempt after attempts failed ones:
+// base doubled for each failure after the first, capped at max
+func RetryDelay(attempts int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// stubWebhookRepository hands out its due deliveries once and records the
+// attempts made on them
+type stubWebhookRepository struct {
+	repository.WebhookRepository
+	due      []models.WebhookDelivery
+	attempts map[int64]*models.DeliveryAttempt
+	enqueued []*models.Event
+}
+
+func (r *stubWebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	due := r.due
+	r.due = nil
+	return due, nil
+}
+
+func (r *stubWebhookRepository) RecordAttempt(ctx context.Context, id int64, attempt *models.DeliveryAttempt) error {
+	if r.attempts == nil {
+		r.attempts = map[int64]*models.DeliveryAttempt{}
+	}
+	r.attempts[id] = attempt
+	return nil
+}
+
+func (r *stubWebhookRepository) EnqueueDeliveries(ctx context.Context, event *models.Event) (int64, error) {
+	r.enqueued = append(r.enqueued, event)
+	return 1, nil
+}
+
+func newTestDispatcher(repo repository.WebhookRepository, now time.Time) *WebhookDispatcher {
+	d := NewWebhookDispatcher(repo, time.Second, 3, time.Minute, time.Hour)
+	d.now = func() time.Time { return now }
+	return d
+}
+
+func TestWebhookDispatcher_DeliversSignedPayload(t *testing.T) {
+	payload := `{"id":"evt-1","type":"order.created","data":{}}`
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	received := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+		if timestamp != now.Unix() {
+			t.Errorf("expected timestamp %d, got %d", now.Unix(), timestamp)
+		}
+		if got, want := r.Header.Get(WebhookSignatureHeader), SignWebhook("s3cret-s3cret-s3cret", timestamp, body); got != want {
+			t.Errorf("expected signature %s, got %s", want, got)
+		}
+		if r.Header.Get(WebhookEventTypeHeader) != "order.created" || r.Header.Get(WebhookEventIDHeader) != "evt-1" {
+			t.Errorf("unexpected event headers %v", r.Header)
+		}
+		if string(body) != payload {
+			t.Errorf("unexpected body %s", body)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	repo := &stubWebhookRepository{due: []models.WebhookDelivery{{
+		ID: 1, EventID: "evt-1", EventType: "order.created", Payload: []byte(payload),
+		URL: receiver.URL, Secret: "s3cret-s3cret-s3cret",
+	}}}
+	sent, err := newTestDispatcher(repo, now).DispatchDue(context.Background())
+	if err != nil || sent != 1 || received != 1 {
+		t.Fatalf("expected one delivery, got sent=%d received=%d err=%v", sent, received, err)
+	}
+	attempt := repo.attempts[1]
+	if attempt.Status != models.DeliveryDelivered || attempt.StatusCode == nil || *attempt.StatusCode != http.StatusNoContent {
+		t.Errorf("expected a delivered attempt with status 204, got %+v", attempt)
+	}
+}
+
+func TestWebhookDispatcher_RetriesThenDeadLetters(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := &stubWebhookRepository{due: []models.WebhookDelivery{
+		{ID: 1, Attempts: 1, Payload: []byte(`{}`), URL: receiver.URL},
+		{ID: 2, Attempts: 2, Payload: []byte(`{}`), URL: receiver.URL},
+	}}
+	if _, err := newTestDispatcher(repo, now).DispatchDue(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	retried := repo.attempts[1]
+	if retried.Status != models.DeliveryPending || retried.RetryAfter == nil || *retried.RetryAfter != 2*time.Minute {
+		t.Errorf("expected a retry 2 minutes after the second failure, got %+v", retried)
+	}
+	if retried.StatusCode == nil || *retried.StatusCode != http.StatusServiceUnavailable || retried.Error == "" {
+		t.Errorf("expected the 503 to be recorded, got %+v", retried)
+	}
+	dead := repo.attempts[2]
+	if dead.Status != models.DeliveryDead || dead.RetryAfter != nil {
+		t.Errorf("expected the third failure to dead-letter the delivery, got %+v", dead)
+	}
+}
+
+func TestWebhookDispatcher_UnreachableReceiver(t *testing.T) {
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url := receiver.URL
+	receiver.Close()
+
+	repo := &stubWebhookRepository{due: []models.WebhookDelivery{{ID: 1, Payload: []byte(`{}`), URL: url}}}
+	if _, err := newTestDispatcher(repo, time.Now()).DispatchDue(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempt := repo.attempts[1]; attempt.Status != models.DeliveryPending || attempt.StatusCode != nil || attempt.Error == "" {
+		t.Errorf("expected a retry without a status code, got %+v", attempt)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := RetryDelay(tt.attempts, 30*time.Second, time.Hour); got != tt.want {
+			t.Errorf("RetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestApplySubscriptionInput(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name  string
+		input models.WebhookSubscriptionInput
+		ok    bool
+	}{
+		{"valid", models.WebhookSubscriptionInput{URL: str("https://example.com/h"), EventTypes: []string{"order.created"}}, true},
+		{"relative url", models.WebhookSubscriptionInput{URL: str("/hooks")}, false},
+		{"ftp url", models.WebhookSubscriptionInput{URL: str("ftp://example.com")}, false},
+		{"unknown event", models.WebhookSubscriptionInput{EventTypes: []string{"order.deleted"}}, false},
+		{"no events", models.WebhookSubscriptionInput{EventTypes: []string{}}, false},
+		{"short secret", models.WebhookSubscriptionInput{Secret: str("abc")}, false},
+	}
+	for _, tt := range tests {
+		err := applySubscriptionInput(&models.WebhookSubscription{}, &tt.input)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: expected ok=%v, got %v", tt.name, tt.ok, err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/sabina/orders-api/internal/models"
+	"github.com/sabina/orders-api/internal/repository"
+)
+
+// ErrSubscriptionNotFound is returned when the requested webhook subscription
+// does not exist
+var ErrSubscriptionNotFound = &Error{
+	Kind:    KindNotFound,
+	Code:    "webhook_not_found",
+	Message: repository.ErrSubscriptionNotFound.Error(),
+	Err:     repository.ErrSubscriptionNotFound,
+}
+
+// maxDeliveryListLimit caps how many deliveries one log request returns
+const maxDeliveryListLimit = 100
+
+// WebhookServiceInterface defines the contract for webhook service
+type WebhookServiceInterface interface {
+	CreateSubscription(ctx context.Context, input *models.WebhookSubscriptionInput) (*models.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id int64) (*models.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, id int64, input *models.WebhookSubscriptionInput) (*models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id int64) error
+	ListDeliveries(ctx context.Context, subscriptionID int64, status string, limit int) ([]models.WebhookDelivery, error)
+}
+
+// WebhookService manages subscriptions and queues a delivery of each
+// published event for every subscription to its type
+type WebhookService struct {
+	repo repository.WebhookRepository
+}
+
+func NewWebhookService(repo repository.WebhookRepository) *WebhookService {
+	return &WebhookService{repo: repo}
+}
+
+// Publish queues event for delivery to its subscribers, making WebhookService
+// a Publisher. Sending happens in the background, in a WebhookDispatcher.
+func (s *WebhookService) Publish(ctx context.Context, event *models.Event) error {
+	_, err := s.repo.EnqueueDeliveries(ctx, event)
+	return err
+}
+
+// CreateSubscription creates an active subscription. A secret is generated
+// when none is given; the returned subscription is the only place it is
+// shown.
+func (s *WebhookService) CreateSubscription(ctx context.Context, input *models.WebhookSubscriptionInput) (*models.WebhookSubscription, error) {
+	sub := &models.WebhookSubscription{Active: true}
+	if input.URL == nil {
+		return nil, NewValidationError("url", "required", "url is required")
+	}
+	if input.EventTypes == nil {
+		return nil, NewValidationError("event_types", "required", "event_types is required")
+	}
+	if err := applySubscriptionInput(sub, input); err != nil {
+		return nil, err
+	}
+	if sub.Secret == "" {
+		secret, err := randomHex(32)
+		if err != nil {
+			return nil, err
+		}
+		sub.Secret = secret
+	}
+
+	if err := s.repo.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (s *WebhookService) GetSubscription(ctx context.Context, id int64) (*models.WebhookSubscription, error) {
+	sub, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, translateRepoError(err)
+	}
+	sub.Secret = ""
+	return sub, nil
+}
+
+func (s *WebhookService) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	subs, err := s.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	return subs, nil
+}
+
+// UpdateSubscription changes the fields set in input, e.g. to rotate the
+// secret or pause deliveries with active=false
+func (s *WebhookService) UpdateSubscription(ctx context.Context, id int64, input *models.WebhookSubscriptionInput) (*models.WebhookSubscription, error) {
+	sub, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, translateRepoError(err)
+	}
+	if err := applySubscriptionInput(sub, input); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateSubscription(ctx, sub); err != nil {
+		return nil, translateRepoError(err)
+	}
+	sub.Secret = ""
+	return sub, nil
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, id int64) error {
+	return translateRepoError(s.repo.DeleteSubscription(ctx, id))
+}
+
+// ListDeliveries returns a subscription's delivery log, newest first
+func (s *WebhookService) ListDeliveries(ctx context.Context, subscriptionID int64, status string, limit int) ([]models.WebhookDelivery, error) {
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		return nil, NewValidationError("status", "unknown_value", fmt.Sprintf("unknown delivery status %q; allowed: pending, delivered, dead", status))
+	}
+	if limit < 1 || limit > maxDeliveryListLimit {
+		limit = maxDeliveryListLimit
+	}
+	if _, err := s.repo.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, translateRepoError(err)
+	}
+	return s.repo.ListDeliveries(ctx, subscriptionID, status, limit)
+}
+
+// applySubscriptionInput validates the fields set in input and copies them
+// onto sub
+func applySubscriptionInput(sub *models.WebhookSubscription, input *models.WebhookSubscriptionInput) error {
+	if input.URL != nil {
+		target, err := url.Parse(strings.TrimSpace(*input.URL))
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return NewValidationError("url", "invalid_format", "url must be an absolute http or https URL")
+		}
+		sub.URL = target.String()
+	}
+	if input.EventTypes != nil {
+		if len(input.EventTypes) == 0 {
+			return NewValidationError("event_types", "required", "event_types must list at least one event type")
+		}
+		var types []string
+		for _, eventType := range input.EventTypes {
+			if !models.IsEventType(eventType) {
+				return NewValidationError("event_types", "unknown_value",
+					fmt.Sprintf("unknown event type %q; allowed: %s", eventType, strings.Join(models.EventTypes, ", ")))
+			}
+			if !containsString(types, eventType) {
+				types = append(types, eventType)
+			}
+		}
+		sub.EventTypes = types
+	}
+	if input.Secret != nil {
+		if len(*input.Secret) < 16 {
+			return NewValidationError("secret", "too_short", "secret must be at least 16 characters")
+		}
+		sub.Secret = *input.Secret
+	}
+	if input.Active != nil {
+		sub.Active = *input.Active
+	}
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -1,38 +1,48 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/sabina/orders-api/internal/config"
 	"github.com/sabina/orders-api/internal/database"
 	"github.com/sabina/orders-api/internal/handlers"
+	"github.com/sabina/orders-api/internal/models"
 	"github.com/sabina/orders-api/internal/repository"
 	"github.com/sabina/orders-api/internal/service"
 )
 
 func main() {
 	// Check for migration commands
-		       if len(os.Args) > 1 {
-			       switch os.Args[1] {
-			       case "migrate":
-				       runMigrations(true)
-				       return
-			       case "migrate-down":
-				       runMigrations(false)
-				       return
-			       case "seed":
-				       runSeed()
-				       return
-			       }
-		       }
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			runMigrations(true)
+			return
+		case "migrate-down":
+			runMigrations(false)
+			return
+		case "seed":
+			runSeed()
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		}
+	}
 
 	// Load configuration
 	cfg, err := config.Load()
@@ -49,11 +59,47 @@ func main() {
 
 	// Initialize repository, service, and handlers
 	orderRepo := repository.NewPostgresOrderRepository(db.DB)
-	orderService := service.NewOrderService(orderRepo)
-	orderHandler := handlers.NewOrderHandler(orderService, cfg.Pagination.DefaultPageSize, cfg.Pagination.MaxPageSize)
+	webhookRepo := repository.NewPostgresWebhookRepository(db.DB)
+	webhookService := service.NewWebhookService(webhookRepo)
+	webhookDispatcher := service.NewWebhookDispatcher(webhookRepo, cfg.Webhook.Timeout, cfg.Webhook.MaxAttempts, cfg.Webhook.RetryBase, cfg.Webhook.RetryMax)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	orderService := service.NewOrderService(orderRepo, cfg.Currency.Supported, cfg.Currency.Default)
+	publisher, closePublisher, err := newPublisher(&cfg.Outbox, webhookService)
+	if err != nil {
+		log.Fatalf("Failed to create event publisher: %v", err)
+	}
+	defer closePublisher()
+	outboxRepo := repository.NewPostgresOutboxRepository(db.DB)
+	// The lease outlasts a batch of publishes that all time out
+	outboxLease := cfg.Outbox.HTTPTimeout*time.Duration(cfg.Outbox.BatchSize) + time.Minute
+	outboxDispatcher := service.NewOutboxDispatcher(outboxRepo, publisher,
+		cfg.Outbox.BatchSize, outboxLease, cfg.Outbox.RetryBase, cfg.Outbox.RetryMax)
+	orderStream := service.NewOrderStream(outboxRepo, repository.NewPostgresOutboxListener(cfg.Database.ConnectionString()))
+	idempotencyRepo := repository.NewPostgresIdempotencyRepository(db.DB)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo, cfg.Idempotency.TTL, cfg.Idempotency.Lease)
+	orderHandler := handlers.NewOrderHandler(orderService, cfg.Pagination.DefaultPageSize, cfg.Pagination.MaxPageSize).
+		WithIdempotency(idempotencyService).
+		WithMaxBatchSize(cfg.Batch.MaxOrders).
+		WithStream(orderStream)
+	reportRepo := repository.NewPostgresReportRepository(db.DB)
+	reportService := service.NewReportService(reportRepo, orderRepo)
+	reportHandler := handlers.NewReportHandler(reportService)
+
+	// Start background workers; they stop when the server shuts down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go idempotencyService.RunSweeper(workerCtx, cfg.Idempotency.SweepInterval)
+	go webhookDispatcher.Run(workerCtx, cfg.Webhook.PollInterval)
+	go orderStream.Run(workerCtx)
+	outboxDone := make(chan struct{})
+	go func() {
+		defer close(outboxDone)
+		outboxDispatcher.Run(workerCtx, cfg.Outbox.PollInterval)
+	}()
+	go outboxDispatcher.RunSweeper(workerCtx, cfg.Outbox.SweepInterval, cfg.Outbox.Retention)
 
 	// Setup routes
-	router := handlers.SetupRoutes(orderHandler)
+	router := handlers.SetupRoutes(orderHandler, reportHandler, webhookHandler)
 
 	// Create HTTP server
 	serverAddr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
@@ -64,6 +110,9 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	// Order streams never finish on their own; end them so that Shutdown
+	// does not wait for them
+	server.RegisterOnShutdown(orderStream.Close)
 
 	// Start server in goroutine
 	go func() {
@@ -79,6 +128,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopWorkers()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -87,26 +137,186 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Let an in-flight outbox batch record what it published and release the
+	// rest
+	select {
+	case <-outboxDone:
+	case <-ctx.Done():
+		log.Println("Outbox dispatcher did not stop in time")
+	}
+
 	log.Println("Server exited")
 }
 
+// newPublisher builds the publisher order events go through: webhook
+// subscriptions, plus the publisher selected by cfg. The returned func
+// releases the publisher's resources.
+func newPublisher(cfg *config.OutboxConfig, webhooks service.Publisher) (service.Publisher, func(), error) {
+	publishers := service.MultiPublisher{webhooks}
+	closePublisher := func() {}
+	switch cfg.Publisher {
+	case "log":
+		publishers = append(publishers, service.LogPublisher{})
+	case "file":
+		filePublisher, err := service.NewFilePublisher(cfg.FilePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		publishers = append(publishers, filePublisher)
+		closePublisher = func() { filePublisher.Close() }
+	case "http":
+		publishers = append(publishers, service.NewHTTPPublisher(cfg.HTTPURL, cfg.HTTPTimeout))
+	}
+	return publishers, closePublisher, nil
+}
+
 func runSeed() {
-       cfg, err := config.Load()
-       if err != nil {
-	       log.Fatalf("Failed to load configuration: %v", err)
-       }
-
-       db, err := database.New(&cfg.Database)
-       if err != nil {
-	       log.Fatalf("Failed to connect to database: %v", err)
-       }
-       defer db.Close()
-
-       // Seed 50 sample orders
-       if err := database.SeedOrders(db.DB, 50); err != nil {
-	       log.Fatalf("Failed to seed orders: %v", err)
-       }
-       log.Println("Successfully seeded 50 sample orders.")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	// Seed 50 sample orders
+	if err := database.SeedOrders(db.DB, 50); err != nil {
+		log.Fatalf("Failed to seed orders: %v", err)
+	}
+	log.Println("Successfully seeded 50 sample orders.")
+}
+
+// runExport writes orders with their items to a file or stdout as
+// newline-delimited JSON
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	out := flags.String("out", "", "output file (default stdout)")
+	statuses := flags.String("status", "", "comma-separated statuses to export")
+	customerIDs := flags.String("customer-id", "", "comma-separated customer IDs to export")
+	currency := flags.String("currency", "", "only export orders in this currency")
+	from := flags.String("from", "", "only export orders created on or after this date (YYYY-MM-DD)")
+	to := flags.String("to", "", "only export orders created on or before this date (YYYY-MM-DD)")
+	flags.Parse(args)
+
+	filter := &models.OrderFilter{
+		Statuses:    splitList(*statuses),
+		CustomerIDs: splitList(*customerIDs),
+	}
+	for _, status := range filter.Statuses {
+		if !models.OrderStatus(status).IsValid() {
+			log.Fatalf("Unknown status %q", status)
+		}
+	}
+	if *currency != "" {
+		upper := strings.ToUpper(*currency)
+		filter.Currency = &upper
+	}
+	filter.FromDate = parseDateFlag("from", *from)
+	filter.ToDate = parseDateFlag("to", *to)
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	w := os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *out, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	buffered := bufio.NewWriter(w)
+	exported, err := database.ExportOrders(context.Background(), db.DB, buffered, filter)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		log.Fatalf("Failed to export orders: %v", err)
+	}
+	log.Printf("Exported %d orders.", exported)
+}
+
+// runImport loads orders written by export from a file or stdin
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	in := flags.String("in", "", "input file (default stdin)")
+	dryRun := flags.Bool("dry-run", false, "validate and apply the import, then roll it back")
+	onConflict := flags.String("on-conflict", string(database.ConflictFail), "what to do with orders whose ID already exists: skip, overwrite or fail")
+	flags.Parse(args)
+
+	opts := database.ImportOptions{OnConflict: database.ConflictPolicy(*onConflict), DryRun: *dryRun}
+	if !opts.OnConflict.IsValid() {
+		log.Fatalf("Unknown conflict policy %q; allowed: skip, overwrite, fail", *onConflict)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := database.New(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	r := os.Stdin
+	if *in != "" {
+		file, err := os.Open(*in)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", *in, err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	result, err := database.ImportOrders(context.Background(), db.DB, bufio.NewReader(r), opts)
+	if err != nil {
+		log.Fatalf("Failed to import orders: %v", err)
+	}
+	summary := fmt.Sprintf("imported %d, overwrote %d, skipped %d orders", result.Imported, result.Overwritten, result.Skipped)
+	if result.RenumberedItems > 0 {
+		summary += fmt.Sprintf(" and renumbered %d items whose IDs belonged to other orders", result.RenumberedItems)
+	}
+	if *dryRun {
+		log.Printf("Dry run, nothing was written: would have %s.", summary)
+		return
+	}
+	log.Printf("Successfully %s.", summary)
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func parseDateFlag(name, value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		log.Fatalf("Invalid -%s date %q; expected YYYY-MM-DD", name, value)
+	}
+	return &date
 }
 
 func runMigrations(up bool) {
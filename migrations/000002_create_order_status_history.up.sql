@@ -0,0 +1,17 @@
+-- Create order_status_history table
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_id BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_order_status_history_order_id ON order_status_history(order_id, changed_at);
+
+-- Start the timeline of existing orders at their creation time
+INSERT INTO order_status_history (order_id, from_status, to_status, actor, reason, changed_at)
+SELECT id, NULL, status, 'system', 'backfilled from existing order', created_at
+FROM orders;
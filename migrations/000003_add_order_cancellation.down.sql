@@ -0,0 +1,9 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_orders_cancellation_reason;
+
+-- Drop columns
+ALTER TABLE orders
+    DROP CONSTRAINT IF EXISTS check_cancellation_reason,
+    DROP COLUMN IF EXISTS cancelled_at,
+    DROP COLUMN IF EXISTS cancellation_note,
+    DROP COLUMN IF EXISTS cancellation_reason;
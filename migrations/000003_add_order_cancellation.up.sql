@@ -0,0 +1,16 @@
+-- Add cancellation details to orders
+ALTER TABLE orders
+    ADD COLUMN cancellation_reason VARCHAR(50),
+    ADD COLUMN cancellation_note TEXT NOT NULL DEFAULT '',
+    ADD COLUMN cancelled_at TIMESTAMP,
+    ADD CONSTRAINT check_cancellation_reason CHECK (
+        cancellation_reason IS NULL
+        OR cancellation_reason IN ('customer_request', 'fraud', 'out_of_stock', 'other')
+    );
+
+-- Orders cancelled before reasons were tracked
+UPDATE orders
+SET cancellation_reason = 'other', cancelled_at = updated_at
+WHERE status = 'cancelled';
+
+CREATE INDEX idx_orders_cancellation_reason ON orders(cancellation_reason);
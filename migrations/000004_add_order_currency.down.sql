@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_orders_currency;
+
+-- Drop columns
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,5 @@
+-- Add ISO-4217 currency to orders; existing orders were implicitly USD
+ALTER TABLE orders
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+CREATE INDEX idx_orders_currency ON orders(currency);
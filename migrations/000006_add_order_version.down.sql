@@ -0,0 +1,3 @@
+-- Drop columns
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS version;
@@ -0,0 +1,3 @@
+-- Add optimistic concurrency version to orders
+ALTER TABLE orders
+    ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
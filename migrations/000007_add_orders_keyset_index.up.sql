@@ -0,0 +1,2 @@
+-- Support keyset pagination on (created_at, id)
+CREATE INDEX idx_orders_created_at_id ON orders(created_at DESC, id DESC);
@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_webhook_deliveries_event;
+DROP INDEX IF EXISTS idx_outbox_events_unsent;
+
+-- Drop tables
+DROP TABLE IF EXISTS outbox_events;
@@ -0,0 +1,3 @@
+-- An unfinished reservation is only held until locked_until, so a key whose
+-- request died can be retried long before the key expires
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
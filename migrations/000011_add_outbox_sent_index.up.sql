@@ -0,0 +1,2 @@
+-- Lets the retention sweep find old sent events without scanning the table
+CREATE INDEX IF NOT EXISTS idx_outbox_events_sent_at ON outbox_events(sent_at) WHERE sent_at IS NOT NULL;
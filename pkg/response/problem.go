@@ -0,0 +1,93 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details
+const ProblemContentType = "application/problem+json"
+
+// problemTypeBase prefixes a problem's code to form its type URI
+const problemTypeBase = "/problems/"
+
+// ProblemDetails is an RFC 7807 problem details object. Code is a stable,
+// machine-readable identifier that clients can branch on and localize; Type
+// is derived from it when empty.
+type ProblemDetails struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+
+	// Extensions are extra members written alongside the standard ones
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON flattens Extensions into the problem object. Standard members
+// take precedence over extensions with the same name.
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	type problem ProblemDetails
+	base, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return base, err
+	}
+
+	members := map[string]json.RawMessage{}
+	if err := json.Unmarshal(base, &members); err != nil {
+		return nil, err
+	}
+	for name, value := range p.Extensions {
+		if _, taken := members[name]; taken {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		members[name] = raw
+	}
+	return json.Marshal(members)
+}
+
+// Problem writes p as application/problem+json, filling in the type, title
+// and instance when they are empty. r may be nil when there is no request to
+// point instance at.
+func Problem(w http.ResponseWriter, r *http.Request, p ProblemDetails) {
+	p = p.WithDefaults(r)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// WithDefaults returns p with the code, type, title and instance filled in
+// the way Problem fills them, for problems embedded in another response
+func (p ProblemDetails) WithDefaults(r *http.Request) ProblemDetails {
+	if p.Code == "" {
+		p.Code = statusCode(p.Status)
+	}
+	if p.Type == "" {
+		p.Type = problemTypeBase + p.Code
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+	return p
+}
+
+// statusCode derives a generic problem code from an HTTP status, e.g.
+// "bad_request" for 400
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
@@ -5,8 +5,12 @@ import (
 	"net/http"
 )
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+// FieldError describes a problem with one request field or query parameter.
+// Code identifies the kind of problem independently of the message.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
@@ -15,6 +19,15 @@ func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// Error writes a problem with a generic code derived from the status. Prefer
+// Problem when the failure has a more specific code.
 func Error(w http.ResponseWriter, statusCode int, message string) {
-	JSON(w, statusCode, ErrorResponse{Error: message})
+	Problem(w, nil, ProblemDetails{Status: statusCode, Detail: message})
+}
+
+// RawJSON writes an already encoded JSON body
+func RawJSON(w http.ResponseWriter, statusCode int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
 }